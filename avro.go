@@ -0,0 +1,539 @@
+package gxutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/spf13/cast"
+)
+
+// Avro is an Avro object container file
+type Avro struct {
+	Path   string
+	File   *os.File
+	Reader io.Reader
+	Codec  string // the compression of the written file: null (default), deflate or snappy
+}
+
+// avroBlockRows is the number of rows of a written block
+const avroBlockRows = 1000
+
+// avroColumn is a column of a record field
+type avroColumn struct {
+	Column
+	field   string // the name of the field
+	logical string // the logical type, e.g. timestamp-micros
+	union   bool   // a union of one type and null, read as a map of the member
+}
+
+// ReadStream returns the read Avro stream into a Datastream. The rows
+// are the records of the file, with a column per field typed from the
+// schema: the unions with null are nullable, the logical types of dates,
+// timestamps and decimals are kept. The nested records, maps, arrays and
+// other unions are read as JSON.
+func (a *Avro) ReadStream() (ds Datastream, err error) {
+	if a.File == nil && a.Reader == nil {
+		file, err := os.Open(a.Path)
+		if err != nil {
+			return ds, Error(err, "os.Open(a.Path)")
+		}
+		a.File = file
+	}
+	if a.Reader == nil {
+		a.Reader = a.File
+	}
+
+	ocfr, err := goavro.NewOCFReader(bufio.NewReader(a.Reader))
+	if err != nil {
+		a.close()
+		return ds, Error(err, "Could not read avro file")
+	}
+
+	columns, err := getAvroColumns(ocfr.MetaData()["avro.schema"])
+	if err != nil {
+		a.close()
+		return ds, err
+	}
+
+	dsColumns := make([]Column, len(columns))
+	for i, col := range columns {
+		dsColumns[i] = col.Column
+	}
+
+	ds = NewDatastream(dsColumns)
+	go func() {
+		defer a.close()
+		defer ds.Close()
+
+		for ocfr.Scan() {
+			datum, err := ocfr.Read()
+			if err != nil {
+				ds.SetError(Error(err, "Error reading file"))
+				return
+			}
+
+			record, _ := datum.(map[string]interface{})
+			row := make([]interface{}, len(columns))
+			for i, col := range columns {
+				row[i] = col.value(record[col.field])
+			}
+			if !ds.push(row) {
+				return
+			}
+		}
+		if err := ocfr.Err(); err != nil {
+			ds.SetError(Error(err, "Error reading file"))
+		}
+	}()
+
+	return ds, nil
+}
+
+func (a *Avro) close() {
+	if a.File != nil {
+		a.File.Close()
+		a.File = nil
+	}
+}
+
+// getAvroColumns returns the columns of the fields of a record schema
+func getAvroColumns(schemaJSON []byte) (columns []avroColumn, err error) {
+	var schema map[string]interface{}
+	if err = json.Unmarshal(schemaJSON, &schema); err != nil {
+		return nil, Error(err, "Could not parse avro schema")
+	} else if schema["type"] != "record" {
+		return nil, errors.New(F("Avro schema is not a record: %s", schemaJSON))
+	}
+
+	named := map[string]interface{}{} // the named types, by name
+	fields, _ := schema["fields"].([]interface{})
+	for i, f := range fields {
+		field, _ := f.(map[string]interface{})
+		col := avroColumn{field: cast.ToString(field["name"])}
+		col.Name = col.field
+		col.Position = int64(i + 1)
+		col.nullableKnown = true
+
+		fieldType := field["type"]
+		if members, ok := fieldType.([]interface{}); ok {
+			// a union, nullable with null
+			others := []interface{}{}
+			for _, member := range members {
+				if member == "null" {
+					col.Nullable = true
+				} else {
+					others = append(others, member)
+				}
+			}
+			fieldType = others
+			if len(others) == 1 {
+				col.union, fieldType = true, others[0]
+			}
+		}
+		col.setType(fieldType, named)
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// setType sets the general type of the column of an avro type
+func (col *avroColumn) setType(avroType interface{}, named map[string]interface{}) {
+	switch t := avroType.(type) {
+	case []interface{}:
+		col.Type = "json" // a union of several types
+		if len(t) == 0 {
+			col.Type = "string"
+		}
+		col.registerNamed(t, named)
+	case string:
+		switch t {
+		case "boolean":
+			col.Type = "bool"
+		case "int", "long":
+			col.Type = "integer"
+		case "float", "double":
+			col.Type, col.floating = "decimal", true
+		case "bytes":
+			col.Type = "binary"
+		case "string", "null":
+			col.Type = "string"
+		default:
+			if definition, ok := named[t]; ok {
+				col.setType(definition, named)
+			} else {
+				col.Type = "string"
+			}
+		}
+	case map[string]interface{}:
+		col.registerNamed(t, named)
+		col.logical = cast.ToString(t["logicalType"])
+		switch col.logical {
+		case "date":
+			col.Type = "date"
+			return
+		case "timestamp-millis", "timestamp-micros":
+			col.Type = "timestamptz"
+			return
+		case "local-timestamp-millis", "local-timestamp-micros":
+			col.Type = "datetime"
+			return
+		case "decimal":
+			col.Type = "decimal"
+			col.Precision, col.Scale = cast.ToInt(t["precision"]), cast.ToInt(t["scale"])
+			return
+		case "time-millis", "time-micros", "uuid":
+			col.Type = "string"
+			return
+		}
+
+		switch t["type"] {
+		case "record", "map":
+			col.Type = "json"
+		case "array":
+			col.Type = "array"
+		case "enum":
+			col.Type = "string"
+		case "fixed":
+			col.Type = "binary"
+		default:
+			col.setType(t["type"], named)
+		}
+	default:
+		col.Type = "string"
+	}
+}
+
+// registerNamed keeps the named types (records, enums and fixed) defined
+// in an avro type, as they can be referred to by name in the next fields
+func (col *avroColumn) registerNamed(avroType interface{}, named map[string]interface{}) {
+	switch t := avroType.(type) {
+	case []interface{}:
+		for _, member := range t {
+			col.registerNamed(member, named)
+		}
+	case map[string]interface{}:
+		if name, ok := t["name"].(string); ok {
+			named[name] = t
+			if namespace, ok := t["namespace"].(string); ok && namespace != "" {
+				named[namespace+"."+name] = t
+			}
+		}
+		for _, key := range []string{"type", "items", "values"} {
+			col.registerNamed(t[key], named)
+		}
+		if fields, ok := t["fields"].([]interface{}); ok {
+			for _, field := range fields {
+				if f, ok := field.(map[string]interface{}); ok {
+					col.registerNamed(f["type"], named)
+				}
+			}
+		}
+	}
+}
+
+// value converts a native avro value to the general type of the column
+func (col *avroColumn) value(val interface{}) interface{} {
+	if union, ok := val.(map[string]interface{}); ok && col.union {
+		for _, member := range union {
+			val = member // the value of the single member
+		}
+	}
+	if val == nil {
+		return nil
+	}
+
+	switch col.Type {
+	case "decimal":
+		switch v := val.(type) {
+		case *big.Rat:
+			return Decimal(v.FloatString(col.Scale))
+		case []byte: // of more than 64 bits
+			return decimalFromUnscaled(unscaledFromBytes(v), col.Scale)
+		case float32:
+			return processVal(v)
+		}
+	case "date", "timestamptz":
+		if t, ok := val.(time.Time); ok {
+			return t.UTC()
+		}
+	case "datetime":
+		if v, ok := val.(int64); ok {
+			if col.logical == "local-timestamp-millis" {
+				return time.Unix(v/1e3, (v%1e3)*1e6).UTC()
+			}
+			return time.Unix(v/1e6, (v%1e6)*1e3).UTC()
+		}
+	case "integer":
+		return cast.ToInt64(val)
+	case "string":
+		switch v := val.(type) {
+		case time.Duration: // time-millis / time-micros
+			return time.Unix(0, int64(v)).UTC().Format("15:04:05.999999")
+		case []byte:
+			return string(v)
+		}
+	case "json", "array":
+		if b, err := json.Marshal(val); err == nil {
+			return string(b)
+		}
+	}
+	return val
+}
+
+// avroNameRegex matches the characters not allowed in avro names
+var avroNameRegex = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// avroName returns a valid avro name of a column
+func avroName(name string) string {
+	name = avroNameRegex.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// avroField is a written field, of a column
+type avroField struct {
+	name      string
+	Type      string // the general type written
+	member    string // the name of the union member, empty if not nullable
+	precision int
+	scale     int
+}
+
+// avroMaxScale is the largest scale of the decimals written exactly
+// by goavro, the larger are written as strings
+const avroMaxScale = 18
+
+// getAvroSchema returns the avro schema of a record of the columns, and
+// its fields. The columns are unions with null unless known not
+// nullable, and typed as: integer long, decimal a fixed decimal(p,s),
+// date date, datetime local-timestamp-micros, timestamptz
+// timestamp-micros, bool boolean, binary bytes, others string. The
+// decimals of unknown precision are decimal(38,s), with s the largest
+// scale of the buffered values, or double if their values are floats
+// (see floatColumn). The names are made of letters, digits
+// and underscores.
+func getAvroSchema(columns []Column, buffer [][]interface{}) (schema string, fields []avroField) {
+	typeMap := map[string]string{
+		"bool":    "boolean",
+		"integer": "long",
+		"binary":  "bytes",
+		"double":  "double",
+	}
+
+	schemaFields := make([]map[string]interface{}, len(columns))
+	fields = make([]avroField, len(columns))
+	for i, col := range columns {
+		field := avroField{name: avroName(col.Name), Type: col.Type, member: "string"}
+		var fieldType interface{} = "string"
+
+		if floatColumn(col, i, buffer) {
+			field.Type = "double"
+		} else if field.Type == "decimal" {
+			field.precision, field.scale = decimalSize(col, i, buffer)
+			if field.scale > avroMaxScale {
+				field.Type = "string"
+			}
+		}
+
+		switch field.Type {
+		case "decimal":
+			field.member = field.name + "_decimal"
+			fieldType = map[string]interface{}{
+				"type": "fixed", "name": field.member, "size": decimalLength(field.precision),
+				"logicalType": "decimal", "precision": field.precision, "scale": field.scale,
+			}
+		case "date":
+			field.member = "int.date"
+			fieldType = map[string]interface{}{"type": "int", "logicalType": "date"}
+		case "datetime":
+			field.member = "long" // the logical type is not known to goavro
+			fieldType = map[string]interface{}{"type": "long", "logicalType": "local-timestamp-micros"}
+		case "timestamptz":
+			field.member = "long.timestamp-micros"
+			fieldType = map[string]interface{}{"type": "long", "logicalType": "timestamp-micros"}
+		default:
+			if t, ok := typeMap[field.Type]; ok {
+				field.member, fieldType = t, t
+			}
+		}
+
+		if col.nullableKnown && !col.Nullable {
+			field.member = ""
+		} else {
+			fieldType = []interface{}{"null", fieldType}
+		}
+		schemaFields[i] = map[string]interface{}{"name": field.name, "type": fieldType}
+		fields[i] = field
+	}
+
+	schemaBytes, _ := json.Marshal(map[string]interface{}{
+		"type": "record", "name": "Row", "fields": schemaFields,
+	})
+	return string(schemaBytes), fields
+}
+
+// avroValue converts a value to the native avro value of its field
+func avroValue(val interface{}, col Column, field avroField) (interface{}, error) {
+	if v, ok := val.(string); ok && col.Type != "" && col.Type != "string" && col.Type != "text" {
+		val = castVal(v, col.Type) // not cast upstream
+	}
+	if val == nil {
+		if field.member == "" {
+			return nil, errors.New("null value in a not nullable column")
+		}
+		return nil, nil
+	}
+
+	var err error
+	switch field.Type {
+	case "decimal":
+		d, ok := toDecimal(val)
+		if !ok {
+			return nil, errors.New(F("value %v is not a decimal", val))
+		}
+		unscaled, err := d.unscaledFit(field.precision, field.scale)
+		if err != nil {
+			return nil, err
+		}
+		denom := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(field.scale)), nil)
+		val = new(big.Rat).SetFrac(unscaled, denom)
+	case "date", "datetime", "timestamptz":
+		t, ok := val.(time.Time)
+		if !ok {
+			return nil, errors.New(F("value %v is not a timestamp", val))
+		}
+		switch field.Type {
+		case "date":
+			val = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		case "datetime":
+			// the wall clock, in micros
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+			val = t.Unix()*1e6 + int64(t.Nanosecond()/1e3)
+		default:
+			val = t.UTC()
+		}
+	case "double":
+		if d, ok := val.(Decimal); ok {
+			val = d.Float64()
+		} else {
+			val, err = cast.ToFloat64E(val)
+		}
+	case "integer":
+		val, err = cast.ToInt64E(val)
+	case "bool":
+		val, err = cast.ToBoolE(val)
+	case "binary":
+		if s, ok := val.(string); ok {
+			val = []byte(s)
+		}
+	default:
+		switch v := val.(type) {
+		case []byte:
+			val = string(v)
+		case json.RawMessage:
+			val = string(v)
+		case time.Time:
+			val = formatTime(v, col.Type)
+		default:
+			val = cast.ToString(val)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if field.member != "" {
+		return goavro.Union(field.member, val), nil
+	}
+	return val, nil
+}
+
+// WriteStream writes the stream as an Avro object container file, with
+// the schema generated from the columns (see getAvroSchema)
+func (a *Avro) WriteStream(ds Datastream) (cnt uint64, err error) {
+	codec := strings.ToLower(a.Codec)
+	if codec == "" {
+		codec = goavro.CompressionNullLabel
+	}
+	switch codec {
+	case goavro.CompressionNullLabel, goavro.CompressionDeflateLabel, goavro.CompressionSnappyLabel:
+	default:
+		ds.Cancel()
+		return cnt, errors.New(F("Invalid avro codec '%s', not null, deflate or snappy", a.Codec))
+	}
+
+	ds, err = sampleDecimals(&ds)
+	if err != nil {
+		return cnt, err
+	}
+
+	if a.File == nil {
+		file, err := os.Create(a.Path)
+		if err != nil {
+			ds.Cancel()
+			return cnt, err
+		}
+		a.File = file
+	}
+	defer a.File.Close()
+
+	schema, fields := getAvroSchema(ds.Columns, ds.Buffer)
+	w := bufio.NewWriter(a.File)
+	ocfw, err := goavro.NewOCFWriter(goavro.OCFConfig{W: w, Schema: schema, CompressionName: codec})
+	if err != nil {
+		ds.Cancel()
+		return cnt, Error(err, "Could not create avro writer")
+	}
+
+	block := make([]interface{}, 0, avroBlockRows)
+	writeBlock := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		err := ocfw.Append(block)
+		block = block[:0]
+		return err
+	}
+
+	for row := range ds.Rows {
+		cnt++
+		record := make(map[string]interface{}, len(fields))
+		for i, col := range ds.Columns {
+			var val interface{}
+			if i < len(row) {
+				val = row[i]
+			}
+			record[fields[i].name], err = avroValue(val, col, fields[i])
+			if err != nil {
+				ds.Cancel()
+				return cnt, Error(err, "Could not write avro record, column "+col.Name)
+			}
+		}
+
+		block = append(block, record)
+		if len(block) == avroBlockRows {
+			if err = writeBlock(); err != nil {
+				ds.Cancel()
+				return cnt, Error(err, "Could not write avro block")
+			}
+		}
+	}
+
+	if err := ds.Err(); err != nil {
+		return cnt, Error(err, "Upstream stream failed, avro file is incomplete")
+	}
+	if err = writeBlock(); err != nil {
+		return cnt, Error(err, "Could not write avro block")
+	}
+	return cnt, w.Flush()
+}
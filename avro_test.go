@@ -0,0 +1,160 @@
+package gxutil
+
+import (
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvro(t *testing.T) {
+	created := time.Date(2020, 3, 25, 10, 30, 15, 123456000, time.UTC)
+	data := Dataset{
+		Columns: []Column{
+			{Name: "id", Type: "integer", nullableKnown: true},
+			{Name: "amount", Type: "decimal", Precision: 30, Scale: 2},
+			{Name: "price", Type: "decimal", Precision: 9, Scale: 3},
+			{Name: "ratio", Type: "decimal"},
+			{Name: "day", Type: "date"},
+			{Name: "created", Type: "datetime"},
+			{Name: "created_tz", Type: "timestamptz"},
+			{Name: "first name", Type: "string"},
+			{Name: "active", Type: "bool"},
+			{Name: "payload", Type: "binary"},
+		},
+		Rows: [][]interface{}{
+			{int64(1), Decimal("-1234567890123456789012345678.90"), Decimal("1.5"), 0.25, time.Date(2020, 3, 25, 0, 0, 0, 0, time.UTC), created, created.In(time.FixedZone("", 3600)), "a", true, []byte{1, 2}},
+			{int64(2), "5", "-0.001", nil, nil, nil, nil, nil, nil, nil},
+		},
+	}
+
+	avroPath := "test/test.avro"
+	defer os.Remove(avroPath)
+
+	for _, codec := range []string{"", "deflate", "snappy"} {
+		cnt, err := (&Avro{Path: avroPath, Codec: codec}).WriteStream(data.Stream())
+		if !assert.NoError(t, err, codec) {
+			continue
+		}
+		assert.EqualValues(t, 2, cnt)
+
+		ds, err := (&Avro{Path: avroPath}).ReadStream()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, []string{"id", "amount", "price", "ratio", "day", "created", "created_tz", "first_name", "active", "payload"}, ds.GetFields())
+		colTypes := []string{}
+		for _, col := range ds.Columns {
+			colTypes = append(colTypes, col.Type)
+		}
+		assert.Equal(t, []string{"integer", "decimal", "decimal", "decimal", "date", "datetime", "timestamptz", "string", "bool", "binary"}, colTypes)
+		assert.False(t, ds.Columns[0].Nullable)
+		assert.True(t, ds.Columns[1].Nullable)
+		assert.Equal(t, []int{30, 2}, []int{ds.Columns[1].Precision, ds.Columns[1].Scale})
+
+		assert.Equal(t, [][]interface{}{
+			{int64(1), Decimal("-1234567890123456789012345678.90"), Decimal("1.500"), 0.25, time.Date(2020, 3, 25, 0, 0, 0, 0, time.UTC), created, created, "a", true, []byte{1, 2}},
+			{int64(2), Decimal("5.00"), Decimal("-0.001"), nil, nil, nil, nil, nil, nil, nil},
+		}, ds.Collect().Rows)
+		assert.NoError(t, ds.Err())
+	}
+
+	// the generated schema
+	schema, _ := getAvroSchema(data.Columns[:3], nil)
+	assert.Equal(t, `{"fields":[{"name":"id","type":"long"},{"name":"amount","type":["null",{"logicalType":"decimal","name":"amount_decimal","precision":30,"scale":2,"size":13,"type":"fixed"}]},{"name":"price","type":["null",{"logicalType":"decimal","name":"price_decimal","precision":9,"scale":3,"size":4,"type":"fixed"}]}],"name":"Row","type":"record"}`, schema)
+
+	// floats of unknown precision, as doubles
+	floats := Dataset{
+		Columns: []Column{{Name: "f", Type: "decimal"}, {Name: "d", Type: "decimal"}},
+		Rows:    [][]interface{}{{0.5, Decimal("0.5")}, {1.0 / 3.0, "0.25"}, {nil, nil}},
+	}
+	if _, err := (&Avro{Path: avroPath}).WriteStream(floats.Stream()); assert.NoError(t, err) {
+		ds, err := (&Avro{Path: avroPath}).ReadStream()
+		if assert.NoError(t, err) {
+			assert.Equal(t, [][]interface{}{{0.5, Decimal("0.50")}, {1.0 / 3.0, Decimal("0.25")}, {nil, nil}}, ds.Collect().Rows)
+			assert.True(t, ds.Columns[0].floating)
+			assert.False(t, ds.Columns[1].floating)
+
+			// a second trip keeps the doubles
+			schema, _ := getAvroSchema(ds.Columns, nil)
+			assert.Contains(t, schema, `{"name":"f","type":["null","double"]}`)
+		}
+	}
+
+	// written by another tool
+	codec, err := goavro.NewCodec(`{"type": "record", "name": "Event", "namespace": "com.example", "fields": [
+		{"name": "id", "type": ["long", "null"]},
+		{"name": "at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "price", "type": ["null", {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}]},
+		{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}},
+		{"name": "other_kind", "type": "Kind"},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "attrs", "type": ["null", {"type": "record", "name": "Attrs", "fields": [{"name": "k", "type": "string"}]}]},
+		{"name": "value", "type": ["null", "int", "string"]},
+		{"name": "ratio", "type": "double"}
+	]}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	file, _ := os.Create(avroPath)
+	ocfw, err := goavro.NewOCFWriter(goavro.OCFConfig{W: file, Codec: codec})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = ocfw.Append([]interface{}{
+		map[string]interface{}{
+			"id": goavro.Union("long", int64(5)), "at": created, "price": goavro.Union("bytes.decimal", big.NewRat(-1234, 100)),
+			"kind": "B", "other_kind": "A", "tags": []interface{}{"x", "y"}, "attrs": goavro.Union("com.example.Attrs", map[string]interface{}{"k": "v"}),
+			"value": goavro.Union("int", int32(3)), "ratio": 0.5,
+		},
+		map[string]interface{}{
+			"id": nil, "at": created, "price": nil, "kind": "A", "other_kind": "A", "tags": []interface{}{},
+			"attrs": nil, "value": nil, "ratio": 1.0,
+		},
+	})
+	assert.NoError(t, err)
+	file.Close()
+
+	ds, err := (&Avro{Path: avroPath}).ReadStream()
+	if !assert.NoError(t, err) {
+		return
+	}
+	colTypes := map[string]string{}
+	for _, col := range ds.Columns {
+		colTypes[col.Name] = col.Type
+	}
+	assert.Equal(t, map[string]string{
+		"id": "integer", "at": "timestamptz", "price": "decimal", "kind": "string", "other_kind": "string",
+		"tags": "array", "attrs": "json", "value": "json", "ratio": "decimal",
+	}, colTypes)
+	assert.True(t, ds.Columns[0].Nullable)
+	assert.False(t, ds.Columns[1].Nullable)
+	assert.Equal(t, [][]interface{}{
+		{int64(5), created.Truncate(time.Millisecond), Decimal("-12.34"), "B", "A", `["x","y"]`, `{"k":"v"}`, `{"int":3}`, 0.5},
+		{nil, created.Truncate(time.Millisecond), nil, "A", "A", `[]`, nil, nil, 1.0},
+	}, ds.Collect().Rows)
+	assert.NoError(t, ds.Err())
+
+	// local timestamps in millis, past the nanoseconds of an int64
+	farFuture := time.Date(9999, 12, 31, 23, 59, 59, 999000000, time.UTC)
+	col := avroColumn{logical: "local-timestamp-millis"}
+	col.Type = "datetime"
+	assert.Equal(t, farFuture, col.value(farFuture.Unix()*1e3+999))
+	assert.Equal(t, time.Date(1969, 12, 31, 23, 59, 59, 500000000, time.UTC), col.value(int64(-500)))
+
+	// not nullable, not fitting, or an unknown codec
+	data.Rows = [][]interface{}{{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}}
+	_, err = (&Avro{Path: avroPath}).WriteStream(data.Stream())
+	assert.Error(t, err)
+	data.Rows = [][]interface{}{{int64(1), nil, Decimal("1234567"), nil, nil, nil, nil, nil, nil, nil}}
+	_, err = (&Avro{Path: avroPath}).WriteStream(data.Stream())
+	assert.Error(t, err)
+	data.Rows = [][]interface{}{{int64(1), nil, Decimal("1.0005"), nil, nil, nil, nil, nil, nil, nil}}
+	_, err = (&Avro{Path: avroPath}).WriteStream(data.Stream())
+	assert.Error(t, err)
+	_, err = (&Avro{Path: avroPath, Codec: "zstd"}).WriteStream(data.Stream())
+	assert.Error(t, err)
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
@@ -10,15 +13,17 @@ import (
 	"github.com/dustin/go-humanize"
 	g "github.com/flarco/gxutil"
 	"github.com/integrii/flaggy"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cast"
 )
 
 var version = "0.3"
 
-var start time.Time
 var DbDb *flaggy.Subcommand
 var DbFf *flaggy.Subcommand
 var FfDb *flaggy.Subcommand
+var Templates *flaggy.Subcommand
+var TemplatesValidate *flaggy.Subcommand
 
 var examples = `
 sling --srcDB $POSTGRES_URL --srcTable housing.my_data2 --limit 10 > /tmp/my_data2.csv
@@ -27,6 +32,9 @@ cat /tmp/my_data2.csv | sling --tgtDB $POSTGRES_URL --tgtTable housing.my_data3
 sling --srcDB $POSTGRES_URL --srcTable housing.my_data2 | sling --tgtDB $POSTGRES_URL --tgtTable housing.my_data3
 
 sling --srcDB $POSTGRES_URL --tgtDB $POSTGRES_URL --srcTable housing.my_data2 --tgtTable housing.my_data3
+
+# using database names of ~/.sling/profile.yaml
+sling --srcDB PG1 --tgtDB EDW1 --srcTable housing.my_data2 --tgtTable housing.my_data3
 `
 
 // Config is a config for the sling task
@@ -36,7 +44,37 @@ type Config struct {
 	tgtDB       string
 	tgtTable    string
 	sqlFile     string
+	profile     string
+	templateDir string
+	connType    string
 	s3Bucket    string
+	dateLayouts []string
+	timezone    string
+	tgtTimezone string
+	nullValues  []string
+	booleans    bool
+	keepZeros   bool
+	thousandSep string
+	decimalSep  string
+	delimiter   string
+	quote       string
+	escape      string
+	header      bool
+	noHeader    bool
+	skipLines   int
+	comment     string
+	keepBOM     bool
+	lazyQuotes  bool
+	lineEnding  string
+	noSniff     bool
+	encoding    string
+	replaceBad  bool
+	format      string
+	columns     []string
+	codec       string
+	pqOptions   g.ParquetOptions
+	flatten     g.FlattenOptions
+	csvOptions  g.CSVOptions
 	limit       uint64
 	drop        bool
 	truncate    bool
@@ -73,8 +111,8 @@ func Init() {
 	flaggy.DefaultParser.AdditionalHelpPrepend = "Slings data from a data source to a data target."
 
 	// Add a flag to the main program (this will be available in all subcommands as well).
-	flaggy.String(&cfg.srcDB, "", "srcDB", "The source database.")
-	flaggy.String(&cfg.tgtDB, "", "tgtDB", "The target database.")
+	flaggy.String(&cfg.srcDB, "", "srcDB", "The source database (URL or profile name).")
+	flaggy.String(&cfg.tgtDB, "", "tgtDB", "The target database (URL or profile name).")
 	flaggy.String(&cfg.srcTable, "", "srcTable", "The source table.")
 	flaggy.String(&cfg.tgtTable, "", "tgtTable", "The target table.\n")
 	// flaggy.Bool(&cfg.in, "", "in", "Use STDIN  Pipe as source (as CSV format).")
@@ -84,6 +122,37 @@ func Init() {
 	flaggy.Bool(&cfg.drop, "", "drop", "Drop the target table before load (default appends).")
 	flaggy.Bool(&cfg.truncate, "", "truncate", "Truncate the target table before inserting / appending (default drops and recreates).\n")
 	flaggy.String(&cfg.s3Bucket, "", "s3Bucket", "The S3 Bucket to use (for Redshift transfers).")
+	flaggy.String(&cfg.profile, "", "profile", "The path of the profile yaml file (default ~/.sling/profile.yaml).")
+	flaggy.String(&cfg.templateDir, "", "templateDir", "A folder of yaml files overriding the SQL templates (default $GXUTIL_TEMPLATES_DIR).")
+	flaggy.StringSlice(&cfg.dateLayouts, "", "dateLayout", "A Go layout of the dates / datetimes to parse, tried before the defaults (can be repeated).")
+	flaggy.String(&cfg.timezone, "", "timezone", "The timezone of the parsed dates without offset, e.g. America/New_York (default UTC).")
+	flaggy.String(&cfg.tgtTimezone, "", "tgtTimezone", "The timezone that the values with timezone (timestamptz) are written in (default UTC).")
+	flaggy.StringSlice(&cfg.nullValues, "", "nullValue", "A value parsed as null, e.g. NULL or \\N (can be repeated).")
+	flaggy.Bool(&cfg.booleans, "", "booleans", "Parse true / false values as booleans.")
+	flaggy.Bool(&cfg.keepZeros, "", "keepLeadingZeros", "Keep numbers with leading zeros (zip codes) as strings.")
+	flaggy.String(&cfg.thousandSep, "", "thousandsSep", "The thousands separator of the numbers to parse, e.g. ','.")
+	flaggy.String(&cfg.decimalSep, "", "decimalSep", "The decimal separator of the numbers to parse (default '.').\n")
+	flaggy.String(&cfg.format, "", "format", "The format of the STDIN / STDOUT data: csv (default), jsonl, parquet or avro.")
+	flaggy.StringSlice(&cfg.columns, "", "column", "A column of the Parquet data to load, all if none (can be repeated).")
+	flaggy.String(&cfg.codec, "", "codec", "The compression of the written data: snappy (default), gzip, zstd or none for Parquet, null (default), deflate or snappy for Avro.")
+	flaggy.Int64(&cfg.pqOptions.RowGroupSize, "", "rowGroupSize", "The bytes of a row group of the written Parquet data (default 128MB).")
+	flaggy.Int64(&cfg.pqOptions.PageSize, "", "pageSize", "The bytes of a page of the written Parquet data (default 8KB).")
+	flaggy.Int(&cfg.flatten.MaxDepth, "", "flattenDepth", "The levels of nested JSON objects flattened into columns, e.g. address.city (-1 for all, default none).")
+	flaggy.String(&cfg.flatten.Explode, "", "explode", "The flattened name of a JSON array exploded into a row per element, e.g. order.items.")
+	flaggy.String(&cfg.flatten.ParentKey, "", "parentKey", "The flattened name of the key repeated in the exploded rows, e.g. order.id (default the line number).")
+	flaggy.String(&cfg.delimiter, "", "delimiter", "The delimiter of the CSV data, e.g. '|' or 'tab' (default ',').")
+	flaggy.String(&cfg.quote, "", "quote", "The quote character of the CSV data (default '\"').")
+	flaggy.String(&cfg.escape, "", "escape", "The character escaping the quotes in quoted fields, e.g. '\\' (default a doubled quote).")
+	flaggy.Bool(&cfg.header, "", "header", "The CSV data has a header line (not detected).")
+	flaggy.Bool(&cfg.noHeader, "", "noHeader", "The CSV data has no header line (the columns are named col_1, col_2...).")
+	flaggy.Int(&cfg.skipLines, "", "skipLines", "The number of lines to skip at the start of the CSV data.")
+	flaggy.String(&cfg.comment, "", "comment", "The prefix of the comment lines of the CSV data to skip, e.g. '#'.")
+	flaggy.Bool(&cfg.keepBOM, "", "keepBOM", "Keep a leading UTF-8 BOM (stripped by default).")
+	flaggy.Bool(&cfg.lazyQuotes, "", "lazyQuotes", "Allow quotes in unquoted fields, and non-doubled quotes in quoted fields.")
+	flaggy.String(&cfg.lineEnding, "", "lineEnding", "The line ending of the written CSV data, 'lf' or 'crlf' (default 'lf').")
+	flaggy.Bool(&cfg.noSniff, "", "noSniff", "Do not detect the delimiter, quote and header line of the STDIN data.")
+	flaggy.String(&cfg.encoding, "", "encoding", "The encoding of the CSV data: utf-8 (default), latin1, windows-1252, utf-16, utf-16le, utf-16be or shift-jis.")
+	flaggy.Bool(&cfg.replaceBad, "", "replaceInvalid", "Replace the invalid character sequences of the CSV data (and the characters that cannot be written), instead of failing.\n")
 	flaggy.Bool(&showExamples, "", "examples", "Shows some examples.")
 
 	// Create any subcommands and set their parameters.
@@ -101,6 +170,16 @@ func Init() {
 	FfDb = flaggy.NewSubcommand("ff-db")
 	FfDb.Description = "Transfer data from Flat-File to Database"
 
+	Templates = flaggy.NewSubcommand("templates")
+	Templates.Description = "Manage the SQL templates"
+
+	TemplatesValidate = flaggy.NewSubcommand("validate")
+	TemplatesValidate.Description = "Validate the SQL templates (with the overrides of --templateDir)"
+	TemplatesValidate.AddPositionalValue(&cfg.connType, "type", 1, false, "The connection type to validate (default all the templates)")
+
+	Templates.AttachSubcommand(TemplatesValidate, 1)
+	flaggy.AttachSubcommand(Templates, 1)
+
 	// flaggy.AttachSubcommand(DbDb, 1)
 	// flaggy.AttachSubcommand(FfDb, 1)
 	// flaggy.AttachSubcommand(DbFf, 1)
@@ -109,6 +188,15 @@ func Init() {
 	flaggy.SetVersion(version)
 	flaggy.Parse()
 
+	if cfg.templateDir != "" {
+		g.TemplatesDir = cfg.templateDir
+	}
+
+	if TemplatesValidate.Used {
+		g.LogErrorExit(runTemplatesValidate(cfg))
+		return
+	}
+
 	InToDB := (cfg.in && cfg.tgtDB != "")
 	DbToDb := cfg.srcDB != "" && cfg.tgtDB != ""
 	DbToOut := cfg.srcDB != "" && cfg.tgtDB == ""
@@ -120,6 +208,32 @@ func Init() {
 		return
 	}
 
+	err := resolveDbURLs(&cfg)
+	if err != nil {
+		g.LogErrorExit(err)
+	}
+
+	err = setInferOptions(cfg)
+	if err != nil {
+		g.LogErrorExit(err)
+	}
+
+	cfg.csvOptions, err = getCSVOptions(cfg)
+	if err != nil {
+		g.LogErrorExit(err)
+	}
+
+	cfg.format = strings.ToLower(cfg.format)
+	if cfg.format != "" && cfg.format != "csv" && cfg.format != "jsonl" && cfg.format != "parquet" && cfg.format != "avro" {
+		g.LogErrorExit(errors.New(g.F("--format must be 'csv', 'jsonl', 'parquet' or 'avro', not '%s'", cfg.format)))
+	}
+	if cfg.format == "parquet" {
+		cfg.pqOptions.Codec = cfg.codec
+	}
+	if err = cfg.pqOptions.Validate(); err != nil {
+		g.LogErrorExit(err)
+	}
+
 	if InToDB {
 		cfg.file = os.Stdin
 		g.LogErrorExit(runFileToDB(cfg))
@@ -133,6 +247,143 @@ func Init() {
 	}
 }
 
+// resolveDbURLs replaces the profile names in srcDB / tgtDB with their URL
+func resolveDbURLs(c *Config) (err error) {
+	isName := func(db string) bool { return db != "" && !strings.Contains(db, ":") }
+	if !isName(c.srcDB) && !isName(c.tgtDB) {
+		return nil
+	}
+
+	profile, err := g.LoadProfile(c.profile)
+	if err != nil {
+		return g.Error(err, "Could not load profile")
+	}
+
+	c.srcDB, err = profile.ResolveURL(c.srcDB)
+	if err != nil {
+		return g.Error(err, "Could not resolve srcDB")
+	}
+
+	c.tgtDB, err = profile.ResolveURL(c.tgtDB)
+	if err != nil {
+		return g.Error(err, "Could not resolve tgtDB")
+	}
+
+	return nil
+}
+
+// setInferOptions sets the options used to parse the values of files,
+// and the timezone of the written timestamptz values
+func setInferOptions(c Config) (err error) {
+	opts := g.NewInferOptions()
+	opts.DateLayouts = append(c.dateLayouts, opts.DateLayouts...)
+	opts.NullTokens = c.nullValues
+	opts.Booleans = c.booleans
+	opts.KeepLeadingZeros = c.keepZeros
+	opts.ThousandsSeparator = c.thousandSep
+	if c.decimalSep != "" {
+		opts.DecimalSeparator = c.decimalSep
+	}
+
+	if c.timezone != "" {
+		opts.Location, err = time.LoadLocation(c.timezone)
+		if err != nil {
+			return g.Error(err, "Invalid timezone "+c.timezone)
+		}
+	}
+
+	if c.tgtTimezone != "" {
+		g.TargetTimezone, err = time.LoadLocation(c.tgtTimezone)
+		if err != nil {
+			return g.Error(err, "Invalid target timezone "+c.tgtTimezone)
+		}
+	}
+
+	g.DefaultInferOptions = opts
+	return nil
+}
+
+// getCSVOptions returns the dialect of the CSV data read from STDIN,
+// or written to STDOUT
+func getCSVOptions(c Config) (opts g.CSVOptions, err error) {
+	toRune := func(name, value string) (rune, error) {
+		switch strings.ToLower(value) {
+		case "":
+			return 0, nil
+		case "tab", "\\t":
+			return '\t', nil
+		}
+
+		runes := []rune(value)
+		if len(runes) != 1 {
+			return 0, errors.New(g.F("--%s must be a single character, not '%s'", name, value))
+		}
+		return runes[0], nil
+	}
+
+	if opts.Delimiter, err = toRune("delimiter", c.delimiter); err != nil {
+		return
+	}
+	if opts.Quote, err = toRune("quote", c.quote); err != nil {
+		return
+	}
+	if opts.Escape, err = toRune("escape", c.escape); err != nil {
+		return
+	}
+
+	switch strings.ToLower(c.lineEnding) {
+	case "", "lf":
+	case "crlf":
+		opts.LineEnding = "\r\n"
+	default:
+		return opts, errors.New(g.F("--lineEnding must be 'lf' or 'crlf', not '%s'", c.lineEnding))
+	}
+
+	if c.header && c.noHeader {
+		return opts, errors.New("--header and --noHeader cannot be both used")
+	}
+	opts.NoHeader = c.noHeader
+	opts.SkipLines = c.skipLines
+	opts.Comment = c.comment
+	opts.KeepBOM = c.keepBOM
+	opts.LazyQuotes = c.lazyQuotes
+	opts.Encoding = c.encoding
+	opts.ReplaceInvalid = c.replaceBad
+
+	return opts, opts.Validate()
+}
+
+// runTemplatesValidate validates the templates and prints the issues
+func runTemplatesValidate(c Config) (err error) {
+	connTypes := []string{c.connType}
+	if c.connType == "" {
+		connTypes, err = g.TemplateTypes()
+		if err != nil {
+			return g.Error(err, "Could not list the templates")
+		}
+	}
+
+	issueCnt := 0
+	for _, connType := range connTypes {
+		issues, err := g.ValidateTemplate(connType, g.TemplatesDir)
+		if err != nil {
+			return g.Error(err, "Could not validate template for "+connType)
+		}
+
+		for _, issue := range issues {
+			println(issue.String())
+		}
+		issueCnt += len(issues)
+	}
+
+	if issueCnt > 0 {
+		return errors.New(g.F("%d template issue(s) found", issueCnt))
+	}
+
+	g.Log(g.F("validated templates for %s", strings.Join(connTypes, ", ")))
+	return nil
+}
+
 // writeTmpToTarget write from the temp table to the final table
 // data is already in temp table
 func writeTmpToTarget(c Config, tgtConn g.Connection) (err error) {
@@ -183,7 +434,6 @@ func writeTmpToTarget(c Config, tgtConn g.Connection) (err error) {
 }
 
 func runDbToFile(c Config) (err error) {
-	start = time.Now()
 
 	srcConn := g.GetConn(c.srcDB)
 	err = srcConn.Connect()
@@ -193,7 +443,7 @@ func runDbToFile(c Config) (err error) {
 
 	srcConn.SetProp("s3Bucket", c.s3Bucket)
 
-	csv := g.CSV{File: c.file}
+	csv := g.CSV{File: c.file, Options: c.csvOptions}
 
 	sql := `select * from ` + c.srcTable
 
@@ -219,12 +469,24 @@ func runDbToFile(c Config) (err error) {
 		return g.Error(err, "Could not BulkStream: "+sql)
 	}
 
-	cnt, err := csv.WriteStream(stream)
+	progressDone := showProgress(&stream)
+	var cnt uint64
+	if c.format == "jsonl" {
+		cnt, err = (&g.JSONL{File: c.file}).WriteStream(stream)
+	} else if c.format == "parquet" {
+		err = (&g.Parquet{File: c.file, Options: c.pqOptions}).WriteStream(stream)
+		cnt = stream.Progress().Rows
+	} else if c.format == "avro" {
+		cnt, err = (&g.Avro{File: c.file, Codec: c.codec}).WriteStream(stream)
+	} else {
+		cnt, err = csv.WriteStream(stream)
+	}
 	if err != nil {
 		return g.Error(err, "Could not WriteStream")
 	}
+	<-progressDone
 
-	g.Log(g.F("wrote %d rows [%s r/s]", cnt, getRate(cnt)))
+	g.Log(g.F("wrote %d rows [%s]", cnt, progressRates(stream.Progress())+replacedStat(&csv)))
 
 	srcConn.Close()
 	return nil
@@ -234,15 +496,41 @@ func runDbToFile(c Config) (err error) {
 // load into temp table
 // insert / upsert / replace into target table
 func runFileToDB(c Config) (err error) {
-	start = time.Now()
 	tgtConn := g.GetConn(c.tgtDB)
 	err = tgtConn.Connect()
 	if err != nil {
 		return g.Error(err, "Could not connect to: "+tgtConn.GetType())
 	}
 
-	csv := g.CSV{File: c.file}
-	stream, err := csv.ReadStream()
+	var stream g.Datastream
+	csv := g.CSV{File: c.file, Options: c.csvOptions}
+	if c.format == "jsonl" {
+		stream, err = (&g.JSONL{File: c.file, Flatten: c.flatten}).ReadStream()
+	} else if c.format == "parquet" {
+		// parquet files are read from their footer, so STDIN is spooled to a temp file
+		var pqPath string
+		pqPath, err = spoolFile(c.file)
+		if err != nil {
+			return g.Error(err, "Could not spool the parquet data")
+		}
+		defer os.Remove(pqPath)
+		stream, err = (&g.Parquet{Path: pqPath, Select: c.columns}).ReadStream()
+	} else if c.format == "avro" {
+		stream, err = (&g.Avro{File: c.file}).ReadStream()
+	} else {
+		if !c.noSniff {
+			opts, err := csv.Sniff()
+			if err != nil {
+				return g.Error(err, "Could not detect the CSV dialect")
+			}
+			if c.header || c.noHeader {
+				// the header line given is kept, only the dialect is detected
+				csv.Options.NoHeader = c.noHeader
+			}
+			g.Log(g.F("detected CSV delimiter %q, quote %q, header %t", opts.Delimiter, opts.Quote, !csv.Options.NoHeader))
+		}
+		stream, err = csv.ReadStream()
+	}
 	if err != nil {
 		return g.Error(err, "Could not ReadStream")
 	}
@@ -278,19 +566,19 @@ func runFileToDB(c Config) (err error) {
 	}
 
 	g.Log("streaming inserts")
-	// stream.SetProgressBar()
+	progressDone := showProgress(&stream)
 	cnt, err := tgtConn.BulkImportStream(c.tgtTable, stream)
 	if err != nil {
 		return g.Error(err, "Could not InsertStream: "+c.tgtTable)
 	}
-	g.Log(g.F("inserted %d rows [%s r/s]", cnt, getRate(cnt)))
+	<-progressDone
+	g.Log(g.F("inserted %d rows [%s]", cnt, progressRates(stream.Progress())+replacedStat(&csv)))
 
 	tgtConn.Close()
 	return nil
 }
 
 func runDbToDb(c Config) (err error) {
-	start = time.Now()
 
 	// var srcConn, tgtConn PostgresConn
 	srcConn := g.GetConn(c.srcDB)
@@ -362,20 +650,78 @@ func runDbToDb(c Config) (err error) {
 	}
 
 	g.Log("streaming inserts")
-	// stream.SetProgressBar()
+	progressDone := showProgress(&stream)
 	cnt, err := tgtConn.BulkImportStream(c.tgtTable, stream)
 	if err != nil {
 		return g.Error(err, "Could not InsertStream: "+c.tgtTable)
 	}
-	g.Log(g.F("inserted %d rows [%s r/s]", cnt, getRate(cnt)))
+	<-progressDone
+	g.Log(g.F("inserted %d rows [%s]", cnt, progressRates(stream.Progress())))
 
 	srcConn.Close()
 	tgtConn.Close()
 	return nil
 }
 
-func getRate(cnt uint64) string {
-	return humanize.Commaf(math.Round(cast.ToFloat64(cnt) / time.Since(start).Seconds()))
+// showProgress reports the progress of the stream on stderr: a live line
+// when attached to a terminal, periodic logs otherwise.
+// The returned channel is closed once the stream is done.
+func showProgress(stream *g.Datastream) <-chan struct{} {
+	stat, err := os.Stderr.Stat()
+	if err == nil && (stat.Mode()&os.ModeCharDevice) != 0 {
+		return stream.OnProgress(500*time.Millisecond, func(p g.Progress) {
+			fmt.Fprintf(os.Stderr, "\r%s rows [%s]   ", humanize.Comma(int64(p.Rows)), progressRates(p))
+			if p.Done {
+				fmt.Fprintln(os.Stderr)
+			}
+		})
+	}
+
+	return stream.OnProgress(10*time.Second, func(p g.Progress) {
+		if p.Done {
+			return
+		}
+		log.WithFields(log.Fields{
+			"rows":         p.Rows,
+			"bytes":        p.Bytes,
+			"elapsed_sec":  math.Round(p.Elapsed.Seconds()),
+			"rows_per_sec": math.Round(p.RowsPerSec()),
+			"mb_per_sec":   math.Round(p.BytesPerSec()/1e4) / 100,
+		}).Info("progress")
+	})
+}
+
+// progressRates returns the rows/s and MB/s of the progress
+func progressRates(p g.Progress) string {
+	return g.F(
+		"%s r/s, %.2f MB/s",
+		humanize.Commaf(math.Round(p.RowsPerSec())),
+		p.BytesPerSec()/1e6,
+	)
+}
+
+// replacedStat returns the count of the replaced character sequences, if any
+func replacedStat(csv *g.CSV) string {
+	if csv.Replaced() == 0 {
+		return ""
+	}
+	return g.F(", %s invalid sequences replaced", humanize.Comma(int64(csv.Replaced())))
+}
+
+// spoolFile copies file to a temp file, and returns its path
+func spoolFile(file *os.File) (path string, err error) {
+	tmp, err := ioutil.TempFile("", "sling-*")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, file)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
 }
 
 func main() {
@@ -2,11 +2,16 @@ package gxutil
 
 import (
 	"bufio"
-	"context"
-	"encoding/csv"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cast"
@@ -14,11 +19,14 @@ import (
 
 // CSV is a csv object
 type CSV struct {
-	Path    string
-	Columns []Column
-	File    *os.File
-	Data    *Dataset
-	Reader  io.Reader
+	replaced uint64 // first, for 64-bit atomic alignment
+	Path     string
+	Columns  []Column
+	File     *os.File
+	Data     *Dataset
+	Reader   io.Reader
+	Options  CSVOptions
+	sniffed  io.Reader // the reader of Sniff, with the sample read again
 }
 
 // ReadCsv reads CSV and returns dataset
@@ -91,114 +99,219 @@ func (c *CSV) Sample(n int) (Dataset, error) {
 	return data, nil
 }
 
+// BinaryEncoding is the text encoding of the binary values
+// written to CSV files: "base64" (default) or "hex"
+var BinaryEncoding = "base64"
+
+// encodeBinary encodes b with BinaryEncoding
+func encodeBinary(b []byte) string {
+	if BinaryEncoding == "hex" {
+		return hex.EncodeToString(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// decodeBinary decodes s with BinaryEncoding
+func decodeBinary(s string) ([]byte, error) {
+	if BinaryEncoding == "hex" {
+		return hex.DecodeString(strings.TrimPrefix(s, "\\x"))
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
 func toString(val interface{}) string {
 	switch v := val.(type) {
 	case time.Time:
-		return cast.ToTime(val).Format("2006-01-02 15:04:05")
+		return formatTime(v, "")
+	case []byte:
+		return encodeBinary(v)
 	default:
 		_ = fmt.Sprint(v)
 		return cast.ToString(val)
 	}
 }
 
+// columnString returns the text of a value of col
+func columnString(val interface{}, col Column) string {
+	if t, ok := val.(time.Time); ok {
+		return formatTime(t, col.Type)
+	}
+	return toString(val)
+}
+
 func castVal(val interface{}, typ string) interface{} {
+	nVal, _ := castValE(val, typ)
+	return nVal
+}
+
+// castValE casts val to the general type typ, with an error if val
+// is not null and cannot be cast (it would be lost as nil, 0 or false)
+func castValE(val interface{}, typ string) (interface{}, error) {
+	opts := DefaultInferOptions
+	if raw, ok := val.(json.RawMessage); ok {
+		val = string(raw)
+	}
+	if s, ok := val.(string); ok {
+		if opts.isNull(s) {
+			return nil, nil
+		}
+
+		// honour the separators / layouts of the inference
+		switch typ {
+		case "integer":
+			if num, ok := opts.parseNumber(s); ok {
+				val = num
+			}
+		case "decimal":
+			// kept as text, parsed exactly below
+			if num, ok := opts.normalizeNumber(s); ok {
+				val = num
+			}
+		case "bool":
+			if b, ok := opts.parseBool(s); ok {
+				val = b
+			}
+		case "datetime", "date", "timestamp", "timestamptz":
+			if t, ok := opts.parseTime(s); ok {
+				val = t
+			}
+		}
+	}
+
 	var nVal interface{}
+	var err error
 	switch typ {
 	case "string", "text":
 		nVal = cast.ToString(val)
 	case "integer":
-		nVal = cast.ToInt64(val)
+		if d, ok := val.(Decimal); ok {
+			val = d.Float64()
+		}
+		nVal, err = cast.ToInt64E(val)
+		if f, ok := val.(float64); ok && f != math.Trunc(f) {
+			err = errors.New("not an integer")
+		}
 	case "decimal":
-		nVal = cast.ToFloat64(val)
+		if d, ok := toDecimal(val); ok {
+			nVal = d
+		} else {
+			err = errors.New("not a decimal")
+		}
 	case "bool":
-		nVal = cast.ToBool(val)
-	case "datetime", "date", "timestamp":
-		nVal = cast.ToTime(val)
+		nVal, err = cast.ToBoolE(val)
+	case "datetime", "date", "timestamp", "timestamptz":
+		nVal, err = cast.ToTimeE(val)
+	case "binary":
+		switch v := val.(type) {
+		case []byte:
+			nVal = v
+		case string:
+			if b, errDecode := decodeBinary(v); errDecode == nil {
+				nVal = b
+			} else {
+				err = errDecode
+			}
+		}
 	default:
 		nVal = cast.ToString(val)
 	}
 
 	if cast.ToString(val) == "" {
-		nVal = nil
+		return nil, nil
+	} else if err != nil {
+		return nVal, errors.New(F("could not cast %v to %s: %s", val, typ, err.Error()))
 	}
-	return nVal
+	return nVal, nil
 }
 
-// ReadStream returns the read CSV stream with Line 1 as header
-func (c *CSV) ReadStream() (ds Datastream, err error) {
-	var r *csv.Reader
+// textReader returns the reader of the file, decompressed and decoded to UTF-8
+func (c *CSV) textReader() (io.Reader, error) {
+	if c.sniffed != nil {
+		reader := c.sniffed
+		c.sniffed = nil
+		return reader, nil
+	}
 
 	if c.File == nil && c.Reader == nil {
 		file, err := os.Open(c.Path)
 		if err != nil {
-			return ds, Error(err, "os.Open(c.Path)")
+			return nil, Error(err, "os.Open(c.Path)")
 		}
 		c.File = file
 		c.Reader = bufio.NewReader(c.File)
-	} else if c.File != nil {
+	} else if c.Reader == nil {
 		c.Reader = bufio.NewReader(c.File)
 	}
 
 	// decompress if gzip
 	reader, err := Decompress(c.Reader)
 	if err != nil {
-		return ds, Error(err, "Decompress(c.Reader)")
+		return nil, Error(err, "Decompress(c.Reader)")
 	}
 
-	r = csv.NewReader(reader)
-
-	row0, err := r.Read()
+	reader, err = newDecodeReader(reader, c.Options, &c.replaced)
 	if err != nil {
-		return ds, Error(err, "r.Read()")
-	} else if err == io.EOF {
-		return ds, nil
+		return nil, Error(err, "Could not read csv")
 	}
+	return reader, nil
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	ds = Datastream{
-		Rows:    make(chan []interface{}),
-		Columns: c.Columns,
-		context: Context{ctx, cancel},
-	}
+// Replaced returns the number of invalid sequences, or characters
+// that could not be encoded, replaced when read or written
+// (with Options.ReplaceInvalid)
+func (c *CSV) Replaced() uint64 {
+	return atomic.LoadUint64(&c.replaced)
+}
 
-	count := 1
-	if ds.Columns == nil {
-		ds.setFields(row0)
+// ReadStream returns the read CSV stream with Line 1 as header,
+// unless Options.NoHeader
+func (c *CSV) ReadStream() (ds Datastream, err error) {
+	reader, err := c.textReader()
+	if err != nil {
+		return ds, err
+	}
 
-		// collect sample up to 1000 rows and infer types
-		for {
-			row0, err := r.Read()
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return ds, Error(err, "Error reading file")
-			}
+	r, err := newCsvReader(reader, c.Options)
+	if err != nil {
+		return ds, Error(err, "Could not read csv")
+	}
 
-			row := make([]interface{}, len(row0))
-			for i, val := range row0 {
-				row[i] = castVal(val, ds.Columns[i].Type)
-			}
-			ds.Buffer = append(ds.Buffer, row)
-			count++
+	row0, err := r.Read()
+	if err != nil {
+		return ds, Error(err, "r.Read()")
+	}
 
-			if count == 1000 {
-				break
+	// typed with c.Columns, or as strings until the types are inferred
+	dsRaw := NewDatastream(c.Columns)
+	if dsRaw.Columns == nil {
+		if c.Options.NoHeader {
+			fields := make([]string, len(row0))
+			for i := range fields {
+				fields[i] = F("col_%d", i+1)
 			}
+			dsRaw.setFields(fields)
+		} else {
+			dsRaw.setFields(row0)
 		}
+	}
+	columns := dsRaw.Columns
 
-		sampleData := Dataset{Columns: ds.Columns, Rows: ds.Buffer}
-		sampleData.InferColumnTypes()
-		ds.Columns = sampleData.Columns
+	castRow := func(row0 []string) []interface{} {
+		row := make([]interface{}, len(row0))
+		for i, val := range row0 {
+			row[i] = castVal(val, columns[i].Type)
+		}
+		return row
 	}
 
 	go func() {
 		defer c.File.Close()
+		// Ensure that at the end of the loop we close the channel!
+		defer dsRaw.Close()
 
-		for _, row := range ds.Buffer {
-			for i, val := range row {
-				row[i] = castVal(val, ds.Columns[i].Type)
-			}
-			ds.Rows <- row
+		// the first line is data
+		if c.Options.NoHeader && !dsRaw.push(castRow(row0)) {
+			return
 		}
 
 		for {
@@ -206,29 +319,23 @@ func (c *CSV) ReadStream() (ds Datastream, err error) {
 			if err == io.EOF {
 				break
 			} else if err != nil {
-				Check(err, "Error reading file")
-				break
+				dsRaw.SetError(Error(err, "Error reading file"))
+				return
 			}
 
-			row := make([]interface{}, len(row0))
-			for i, val := range row0 {
-				row[i] = castVal(val, ds.Columns[i].Type)
+			if !dsRaw.push(castRow(row0)) {
+				return
 			}
-
-			select {
-			case <-ds.context.ctx.Done():
-				break
-			default:
-				ds.Rows <- row
-			}
-			count++
 		}
-		// Ensure that at the end of the loop we close the channel!
-		close(ds.Rows)
 		c.File = nil
 	}()
 
-	return ds, nil
+	if c.Columns == nil {
+		// collect sample and infer types
+		return dsRaw.InferTypes(SampleSize)
+	}
+
+	return dsRaw, nil
 }
 
 // WriteStream to CSV file
@@ -244,29 +351,43 @@ func (c *CSV) WriteStream(ds Datastream) (cnt uint64, err error) {
 
 	defer c.File.Close()
 
-	w := csv.NewWriter(c.File)
-
-	err = w.Write(ds.GetFields())
+	w, err := newCsvWriter(c.File, c.Options, &c.replaced)
 	if err != nil {
-		return cnt, Error(err, "error write row to csv file")
+		ds.Cancel()
+		return cnt, Error(err, "Could not write csv")
+	}
+
+	if !c.Options.NoHeader {
+		err = w.Write(ds.GetFields())
+		if err != nil {
+			ds.Cancel()
+			return cnt, Error(err, "error write row to csv file")
+		}
 	}
 
 	for row0 := range ds.Rows {
 		cnt++
 		row := make([]string, len(row0))
 		for i, val := range row0 {
-			row[i] = toString(val)
+			row[i] = columnString(val, ds.column(i))
 		}
 		err := w.Write(row)
+		if err == nil {
+			err = w.Flush()
+		}
 		if err != nil {
+			ds.Cancel()
 			return cnt, Error(err, "error write row to csv file")
 		}
-		w.Flush()
 	}
-	return cnt, nil
+
+	if err := ds.Err(); err != nil {
+		return cnt, Error(err, "Upstream stream failed, csv file is incomplete")
+	}
+	return cnt, w.Flush()
 }
 
-// NewReader creates a Reader
+// NewReader creates a Reader of the rows, written with the CSV options
 func (c *CSV) NewReader() (*io.PipeReader, error) {
 	pipeR, pipeW := io.Pipe()
 	ds, err := c.ReadStream()
@@ -274,29 +395,43 @@ func (c *CSV) NewReader() (*io.PipeReader, error) {
 		return nil, err
 	}
 
-	go func() {
-		w := csv.NewWriter(pipeW)
+	w, err := newCsvWriter(pipeW, c.Options, &c.replaced)
+	if err != nil {
+		ds.Cancel()
+		return nil, Error(err, "Could not write csv")
+	}
 
-		err := w.Write(ds.GetFields())
-		if err != nil {
-			Check(err, "Error writing ds.Fields")
-			pipeW.Close()
+	go func() {
+		if !c.Options.NoHeader {
+			err := w.Write(ds.GetFields())
+			if err != nil {
+				ds.Cancel()
+				pipeW.CloseWithError(Error(err, "Error writing ds.Fields"))
+				return
+			}
 		}
 
 		for row0 := range ds.Rows {
 			// convert to csv string
 			row := make([]string, len(row0))
 			for i, val := range row0 {
-				row[i] = toString(val)
+				row[i] = columnString(val, ds.column(i))
 			}
 			err := w.Write(row)
+			if err == nil {
+				err = w.Flush()
+			}
 			if err != nil {
-				Check(err, "Error w.Write(row)")
-				break
+				ds.Cancel()
+				pipeW.CloseWithError(Error(err, "Error w.Write(row)"))
+				return
 			}
-			w.Flush()
 		}
-		pipeW.Close()
+		if err := w.Flush(); err != nil && ds.Err() == nil {
+			pipeW.CloseWithError(Error(err, "Error w.Flush()"))
+			return
+		}
+		pipeW.CloseWithError(ds.Err())
 	}()
 
 	return pipeR, nil
@@ -0,0 +1,529 @@
+package gxutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CSVOptions is the dialect of a CSV file. The zero value is
+// the default: comma delimited, double quoted, with a header line.
+type CSVOptions struct {
+	Delimiter  rune   // default ','
+	Quote      rune   // default '"'
+	Escape     rune   // escapes the quote in a quoted field, default a doubled quote
+	NoHeader   bool   // no header line, the columns are named col_1, col_2...
+	SkipLines  int    // lines skipped at the start of the file, before the header
+	Comment    string // prefix of the lines to skip, e.g. "#"
+	KeepBOM    bool   // keep a leading UTF-8 BOM, stripped by default
+	LazyQuotes bool   // allow quotes in unquoted fields, and non-doubled quotes in quoted fields
+	LineEnding string // written line ending, "\n" (default) or "\r\n"
+
+	// Encoding is the character encoding of the file: utf-8 (default),
+	// latin1, windows-1252, utf-16 (LE, with a BOM), utf-16le, utf-16be
+	// or shift-jis. A UTF-16 BOM is detected when read.
+	Encoding string
+
+	// ReplaceInvalid replaces the invalid sequences read (with U+FFFD),
+	// and the characters that cannot be written (with "?"), instead of
+	// failing. They are counted by CSV.Replaced.
+	ReplaceInvalid bool
+}
+
+const utf8BOM = "\xef\xbb\xbf"
+
+func (o CSVOptions) delimiter() rune {
+	if o.Delimiter == 0 {
+		return ','
+	}
+	return o.Delimiter
+}
+
+func (o CSVOptions) quote() rune {
+	if o.Quote == 0 {
+		return '"'
+	}
+	return o.Quote
+}
+
+func (o CSVOptions) escape() rune {
+	if o.Escape == 0 {
+		return o.quote()
+	}
+	return o.Escape
+}
+
+func (o CSVOptions) lineEnding() string {
+	if o.LineEnding == "" {
+		return "\n"
+	}
+	return o.LineEnding
+}
+
+// Validate checks that the delimiter, quote and escape can be told apart
+func (o CSVOptions) Validate() error {
+	special := map[rune]bool{'\r': true, '\n': true, utf8.RuneError: true}
+	if special[o.delimiter()] || special[o.quote()] || special[o.escape()] {
+		return errors.New("Invalid CSV options: the delimiter, quote and escape cannot be a line break")
+	} else if o.delimiter() == o.quote() || o.delimiter() == o.escape() {
+		return errors.New("Invalid CSV options: the delimiter cannot be the quote or escape")
+	} else if o.LineEnding != "" && o.LineEnding != "\n" && o.LineEnding != "\r\n" {
+		return errors.New(F("Invalid CSV options: line ending %q is not \\n or \\r\\n", o.LineEnding))
+	} else if _, err := getEncoding(o.Encoding); err != nil {
+		return Error(err, "Invalid CSV options")
+	}
+	return nil
+}
+
+// csvReader reads the records of a CSV file with a dialect
+type csvReader struct {
+	r         *bufio.Reader
+	opts      CSVOptions
+	line      int
+	numFields int
+}
+
+// newCsvReader returns a reader of r, past the BOM and the skipped lines
+func newCsvReader(r io.Reader, opts CSVOptions) (*csvReader, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	cr := &csvReader{r: bufio.NewReader(r), opts: opts}
+	if !opts.KeepBOM {
+		if bom, err := cr.r.Peek(len(utf8BOM)); err == nil && string(bom) == utf8BOM {
+			cr.r.Discard(len(utf8BOM))
+		}
+	}
+
+	for i := 0; i < opts.SkipLines; i++ {
+		if err := cr.skipLine(); err != nil {
+			return cr, err
+		}
+	}
+	return cr, nil
+}
+
+func (cr *csvReader) skipLine() error {
+	_, err := cr.r.ReadString('\n')
+	cr.line++
+	return err
+}
+
+func (cr *csvReader) peekRune() (rune, bool) {
+	next, _ := cr.r.Peek(utf8.UTFMax)
+	if len(next) == 0 {
+		return 0, false
+	}
+	r, _ := utf8.DecodeRune(next)
+	return r, true
+}
+
+func (cr *csvReader) errorf(format string, args ...interface{}) error {
+	return errors.New(F("line %d: ", cr.line) + F(format, args...))
+}
+
+// Read returns the next record, or io.EOF. Empty and comment lines are skipped.
+func (cr *csvReader) Read() ([]string, error) {
+	// start of a record
+	for {
+		if cr.opts.Comment != "" {
+			prefix, _ := cr.r.Peek(len(cr.opts.Comment))
+			if string(prefix) == cr.opts.Comment {
+				if err := cr.skipLine(); err == io.EOF {
+					return nil, io.EOF
+				}
+				continue
+			}
+		}
+
+		next, _ := cr.r.Peek(2)
+		if len(next) > 0 && next[0] == '\n' {
+			cr.r.Discard(1)
+		} else if len(next) > 1 && next[0] == '\r' && next[1] == '\n' {
+			cr.r.Discard(2)
+		} else if len(next) == 0 {
+			return nil, io.EOF
+		} else {
+			break
+		}
+		cr.line++
+	}
+	cr.line++
+
+	delimiter, quote, escape := cr.opts.delimiter(), cr.opts.quote(), cr.opts.escape()
+	record := []string{}
+	field := strings.Builder{}
+	fieldStart, quoted, afterQuote := true, false, false
+
+	endField := func() {
+		record = append(record, field.String())
+		field.Reset()
+		fieldStart, quoted, afterQuote = true, false, false
+	}
+
+	for {
+		r, _, err := cr.r.ReadRune()
+		if err == io.EOF {
+			if quoted && !cr.opts.LazyQuotes {
+				return nil, cr.errorf("extraneous or missing %q in quoted field", quote)
+			}
+			endField()
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if quoted {
+			if r == escape && escape != quote {
+				next, _, err := cr.r.ReadRune()
+				if err == nil && next != quote && next != escape {
+					field.WriteRune(r) // not an escape
+				}
+				if err == nil {
+					field.WriteRune(next)
+				}
+				continue
+			} else if r == quote {
+				next, ok := cr.peekRune()
+				if ok && next == quote && escape == quote {
+					cr.r.ReadRune()
+					field.WriteRune(quote) // doubled quote
+					continue
+				} else if ok && cr.opts.LazyQuotes && next != delimiter && next != '\r' && next != '\n' {
+					field.WriteRune(quote) // not the closing quote
+					continue
+				}
+				quoted, afterQuote = false, true
+				continue
+			}
+			if r == '\n' {
+				cr.line++
+			}
+			field.WriteRune(r)
+			continue
+		}
+
+		if r == delimiter {
+			endField()
+			continue
+		} else if r == '\r' {
+			if next, _ := cr.r.Peek(1); len(next) > 0 && next[0] == '\n' {
+				continue // \r\n line ending
+			}
+		} else if r == '\n' {
+			endField()
+			break
+		}
+
+		if fieldStart && r == quote {
+			fieldStart, quoted = false, true
+			continue
+		} else if (r == quote || afterQuote) && !cr.opts.LazyQuotes {
+			if afterQuote {
+				return nil, cr.errorf("extraneous or missing %q in quoted field", quote)
+			}
+			return nil, cr.errorf("bare %q in non-quoted field", quote)
+		}
+
+		fieldStart = false
+		field.WriteRune(r)
+	}
+
+	if cr.numFields == 0 {
+		cr.numFields = len(record)
+	} else if len(record) != cr.numFields {
+		return record, cr.errorf("wrong number of fields (%d, expected %d)", len(record), cr.numFields)
+	}
+	return record, nil
+}
+
+// csvWriter writes the records of a CSV file with a dialect
+type csvWriter struct {
+	w       *bufio.Writer
+	opts    CSVOptions
+	encoder *textEncoder
+	line    strings.Builder
+}
+
+// newCsvWriter returns a writer to w, encoding to opts.Encoding
+// (the replaced characters are counted in replaced)
+func newCsvWriter(w io.Writer, opts CSVOptions, replaced *uint64) (*csvWriter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	encoder, err := newTextEncoder(opts, replaced)
+	if err != nil {
+		return nil, err
+	}
+
+	cw := &csvWriter{w: bufio.NewWriter(w), opts: opts, encoder: encoder}
+	cw.w.WriteString(encoder.bomString())
+	return cw, nil
+}
+
+// fieldNeedsQuotes is true if the field has special characters, a leading
+// space (dropped by some readers), or is `\.` (the end of data for postgres)
+func (cw *csvWriter) fieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	} else if field == `\.` || field[0] == ' ' || field[0] == '\t' {
+		return true
+	}
+	return strings.ContainsAny(
+		field,
+		string([]rune{cw.opts.delimiter(), cw.opts.quote(), cw.opts.escape(), '\r', '\n'}),
+	)
+}
+
+// Write writes a record
+func (cw *csvWriter) Write(record []string) error {
+	quote, escape := cw.opts.quote(), cw.opts.escape()
+	line := &cw.line
+	line.Reset()
+	for i, field := range record {
+		if i > 0 {
+			line.WriteRune(cw.opts.delimiter())
+		}
+
+		if !cw.fieldNeedsQuotes(field) {
+			line.WriteString(field)
+			continue
+		}
+
+		line.WriteRune(quote)
+		for _, r := range field {
+			if r == quote || (r == escape && escape != quote) {
+				line.WriteRune(escape)
+			}
+			line.WriteRune(r)
+		}
+		line.WriteRune(quote)
+	}
+	line.WriteString(cw.opts.lineEnding())
+
+	encoded, err := cw.encoder.String(line.String())
+	if err != nil {
+		return err
+	}
+	_, err = cw.w.WriteString(encoded)
+	return err
+}
+
+// Flush writes the buffered records
+func (cw *csvWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// sniffDelimiters are the delimiters detected by Sniff, by preference
+var sniffDelimiters = []rune{',', '\t', '|', ';'}
+
+// sniffMaxBytes bounds the sample read by Sniff
+const sniffMaxBytes = 10 * 1024 * 1024
+
+// Sniff detects the delimiter, the quote and the header line of the
+// file, from a sample of its first SampleSize lines, like Python's
+// csv.Sniffer. The detected options are set in c.Options, the other
+// options (e.g. SkipLines, Comment) are used to read the sample.
+// A delimiter or quote already set in c.Options is kept.
+func (c *CSV) Sniff() (opts CSVOptions, err error) {
+	reader, err := c.textReader()
+	if err != nil {
+		return c.Options, err
+	}
+
+	// the sample is read again by ReadStream
+	sample := []byte{}
+	bReader := bufio.NewReader(reader)
+	complete := false
+	for i := 0; i < SampleSize+c.Options.SkipLines+1 && len(sample) < sniffMaxBytes; i++ {
+		line, err := bReader.ReadBytes('\n')
+		sample = append(sample, line...)
+		if err == io.EOF {
+			complete = true
+			break
+		} else if err != nil {
+			return c.Options, Error(err, "Could not read csv sample")
+		}
+	}
+	c.sniffed = io.MultiReader(bytes.NewReader(sample), bReader)
+
+	opts = c.Options
+	if opts.Quote == 0 {
+		opts.Quote = sniffQuote(sample, opts)
+	}
+	if opts.Delimiter == 0 {
+		opts.Delimiter = sniffDelimiter(sample, complete, opts)
+	}
+
+	records := sniffRecords(sample, complete, opts)
+	opts.NoHeader = !sniffHeader(records)
+
+	c.Options = opts
+	return opts, nil
+}
+
+// sniffRecords returns the records of the sample, with any number of
+// fields. The last record is dropped if the sample is not complete.
+func sniffRecords(sample []byte, complete bool, opts CSVOptions) (records [][]string) {
+	opts.LazyQuotes = true
+	r, err := newCsvReader(bytes.NewReader(sample), opts)
+	if err != nil {
+		return
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if record == nil {
+			return
+		}
+		r.numFields = 0 // the count is checked by sniffDelimiter
+		records = append(records, record)
+	}
+
+	if !complete && len(records) > 0 {
+		records = records[:len(records)-1]
+	}
+	return
+}
+
+// sniffQuote returns the quote (double or single) found the most
+// around fields, the double quote by default
+func sniffQuote(sample []byte, opts CSVOptions) rune {
+	isBoundary := func(b byte) bool {
+		for _, d := range sniffDelimiters {
+			if rune(b) == d {
+				return true
+			}
+		}
+		return b == '\n' || b == '\r' || b == ' '
+	}
+
+	counts := map[byte]int{}
+	for _, quote := range []byte{'"', '\''} {
+		for i, b := range sample {
+			if b != quote {
+				continue
+			}
+			// an opening quote after a boundary, or a closing quote before one
+			if i == 0 || isBoundary(sample[i-1]) || i == len(sample)-1 || isBoundary(sample[i+1]) {
+				counts[quote]++
+			}
+		}
+	}
+
+	if counts['\''] > counts['"'] {
+		return '\''
+	}
+	return '"'
+}
+
+// sniffDelimiter returns the delimiter splitting the most records into
+// the same number of fields (more than one), the comma by default
+func sniffDelimiter(sample []byte, complete bool, opts CSVOptions) rune {
+	best, bestScore := ',', 0.0
+	for _, delimiter := range sniffDelimiters {
+		opts.Delimiter = delimiter
+		records := sniffRecords(sample, complete, opts)
+		if len(records) == 0 {
+			continue
+		}
+
+		// the most frequent number of fields, and its frequency
+		counts := map[int]int{}
+		modeFields, modeCount := 0, 0
+		for _, record := range records {
+			counts[len(record)]++
+			if c := counts[len(record)]; c > modeCount || (c == modeCount && len(record) > modeFields) {
+				modeFields, modeCount = len(record), c
+			}
+		}
+		if modeFields < 2 {
+			continue
+		}
+
+		score := float64(modeCount) / float64(len(records))
+		if score > bestScore {
+			best, bestScore = delimiter, score
+		}
+	}
+	return best
+}
+
+// sniffHeader returns true if the first record looks like a header:
+// by column, its value is text while the other values are numbers or
+// dates, or its length differs from the other values of a fixed length.
+// It defaults to true (as ReadStream) without evidence.
+func sniffHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return true
+	}
+
+	kind := func(s string) string {
+		switch DefaultInferOptions.ParseString(s).(type) {
+		case nil:
+			return ""
+		case int64, float64:
+			return "number"
+		case time.Time:
+			return "datetime"
+		case bool:
+			return "bool"
+		}
+		return "string"
+	}
+
+	header := records[0]
+	votes := 0
+	names := map[string]bool{}
+	for i, name := range header {
+		if name == "" || names[name] {
+			votes-- // column names are set and unique
+		}
+		names[name] = true
+
+		colKind, colLength := "", -1
+		for _, record := range records[1:] {
+			if i >= len(record) || record[i] == "" {
+				continue
+			}
+
+			if k := kind(record[i]); colKind == "" {
+				colKind = k
+			} else if colKind != k {
+				colKind = "mixed"
+			}
+
+			if colLength == -1 {
+				colLength = len(record[i])
+			} else if colLength != len(record[i]) {
+				colLength = -2
+			}
+		}
+
+		switch {
+		case colKind == "" || colKind == "mixed" || name == "":
+		case colKind != "string":
+			if kind(name) == colKind {
+				votes--
+			} else {
+				votes++
+			}
+		case colLength >= 0:
+			if len(name) == colLength {
+				votes--
+			} else {
+				votes++
+			}
+		}
+	}
+
+	return votes >= 0
+}
@@ -0,0 +1,157 @@
+package gxutil
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVOptions(t *testing.T) {
+	readAll := func(text string, opts CSVOptions) (Dataset, error) {
+		csv1 := CSV{Reader: strings.NewReader(text), Options: opts}
+		ds, err := csv1.ReadStream()
+		if err != nil {
+			return Dataset{}, err
+		}
+		data := ds.Collect()
+		return data, ds.Err()
+	}
+
+	// pipe delimited, skipped lines, comments and a BOM
+	text := utf8BOM + "exported 2020-03-25\n\nid|name\n# a comment\n1|a,b\n2|\"c|d\"\n"
+	data, err := readAll(text, CSVOptions{Delimiter: '|', SkipLines: 2, Comment: "#"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"id", "name"}, data.GetFields())
+		assert.Len(t, data.Rows, 2)
+		assert.Equal(t, "a,b", data.Records()[0]["name"])
+		assert.Equal(t, "c|d", data.Records()[1]["name"])
+	}
+
+	// tab delimited without header, CRLF line endings
+	data, err = readAll("1\tx\r\n2\ty\r\n", CSVOptions{Delimiter: '\t', NoHeader: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"col_1", "col_2"}, data.GetFields())
+		assert.Len(t, data.Rows, 2)
+		assert.Equal(t, "y", data.Records()[1]["col_2"])
+	}
+
+	// single quotes with a backslash escape, and a multiline field
+	data, err = readAll("a,b\n'it\\'s','x\ny'\n", CSVOptions{Quote: '\'', Escape: '\\'})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "it's", data.Records()[0]["a"])
+		assert.Equal(t, "x\ny", data.Records()[0]["b"])
+	}
+
+	// a kept BOM is part of the first field
+	data, err = readAll(utf8BOM+"a\n1\n", CSVOptions{KeepBOM: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, utf8BOM+"a", data.GetFields()[0])
+	}
+
+	// stray quotes
+	_, err = readAll("a,b\n1,x\"y\n", CSVOptions{})
+	assert.Error(t, err)
+	data, err = readAll("a,b\n1,x\"y\n2,\"z\"w\"\n", CSVOptions{LazyQuotes: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "x\"y", data.Records()[0]["b"])
+		assert.Equal(t, "z\"w", data.Records()[1]["b"])
+	}
+
+	_, err = readAll("a,b\n1,2,3\n", CSVOptions{})
+	assert.Error(t, err)
+
+	assert.Error(t, CSVOptions{Delimiter: '"'}.Validate())
+	assert.Error(t, CSVOptions{Quote: '\n'}.Validate())
+	assert.Error(t, CSVOptions{LineEnding: "\r"}.Validate())
+	assert.NoError(t, CSVOptions{Delimiter: ';', LineEnding: "\r\n"}.Validate())
+
+	// written with the dialect, and read back
+	data = Dataset{
+		Columns: []Column{{Name: "id", Type: "string"}, {Name: "note", Type: "string"}},
+		Rows:    [][]interface{}{{"1", "a;b"}, {"2", "it's"}, {"3", ` lead`}},
+	}
+	opts := CSVOptions{Delimiter: ';', Quote: '\'', Escape: '\\', LineEnding: "\r\n"}
+
+	csvPath := "test/dialect.csv"
+	defer os.Remove(csvPath)
+	_, err = (&CSV{Path: csvPath, Options: opts}).WriteStream(data.Stream())
+	assert.NoError(t, err)
+
+	csvBytes, err := ioutil.ReadFile(csvPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "id;note\r\n1;'a;b'\r\n2;'it\\'s'\r\n3;' lead'\r\n", string(csvBytes))
+
+	data2, err := readAll(string(csvBytes), opts)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []interface{}{int64(3), " lead"}, data2.Rows[2])
+		assert.Equal(t, "it's", data2.Records()[1]["note"])
+	}
+
+	// the reader of a file is written with the same dialect
+	reader, err := (&CSV{Path: csvPath, Options: opts}).NewReader()
+	if assert.NoError(t, err) {
+		readerBytes, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, string(csvBytes), string(readerBytes))
+	}
+
+	_, err = (&CSV{Path: csvPath, Options: CSVOptions{NoHeader: true}}).WriteStream(data.Stream())
+	assert.NoError(t, err)
+	csvBytes, _ = ioutil.ReadFile(csvPath)
+	assert.True(t, strings.HasPrefix(string(csvBytes), "1,a;b\n"))
+
+	reader, err = (&CSV{Path: csvPath, Options: CSVOptions{NoHeader: true}}).NewReader()
+	if assert.NoError(t, err) {
+		readerBytes, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, string(csvBytes), string(readerBytes))
+	}
+}
+
+func TestCSVSniff(t *testing.T) {
+	sniff := func(text string) CSVOptions {
+		csv1 := CSV{Reader: strings.NewReader(text)}
+		opts, err := csv1.Sniff()
+		assert.NoError(t, err)
+		return opts
+	}
+
+	opts := sniff("id,name,amount\n1,a,1.5\n2,b,2.5\n")
+	assert.Equal(t, ',', opts.Delimiter)
+	assert.Equal(t, '"', opts.Quote)
+	assert.False(t, opts.NoHeader)
+
+	opts = sniff("id|name|note\n1|\"a\"|x, y\n2|b|z\n3|c|\n")
+	assert.Equal(t, '|', opts.Delimiter)
+	assert.False(t, opts.NoHeader)
+
+	opts = sniff("1\t2020-01-01\tab\n2\t2020-01-02\tcd\n3\t2020-01-03\tef\n")
+	assert.Equal(t, '\t', opts.Delimiter)
+	assert.True(t, opts.NoHeader)
+
+	opts = sniff("code;label\nAB;'x;y'\nCD;'z'\n")
+	assert.Equal(t, ';', opts.Delimiter)
+	assert.Equal(t, '\'', opts.Quote)
+	assert.False(t, opts.NoHeader)
+
+	// the sample is read again, with the detected dialect
+	csv1 := CSV{Reader: strings.NewReader("a;b\n1;x,y\n2;z\n")}
+	_, err := csv1.Sniff()
+	assert.NoError(t, err)
+	ds, err := csv1.ReadStream()
+	if assert.NoError(t, err) {
+		data := ds.Collect()
+		assert.Equal(t, []string{"a", "b"}, data.GetFields())
+		assert.Len(t, data.Rows, 2)
+		assert.Equal(t, "x,y", data.Records()[0]["b"])
+	}
+
+	// a delimiter set in the options is kept
+	csv1 = CSV{Reader: strings.NewReader("a;b,c\n1;2,3\n"), Options: CSVOptions{Delimiter: ';'}}
+	opts, err = csv1.Sniff()
+	assert.NoError(t, err)
+	assert.Equal(t, ';', opts.Delimiter)
+}
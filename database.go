@@ -5,9 +5,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"path"
-	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -18,11 +15,10 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
-	"github.com/markbates/pkger"
 	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
+	"github.com/flarco/stacktrace"
 	"github.com/spf13/cast"
-	"gopkg.in/yaml.v2"
 )
 
 // Connection is the Base interface for Connections
@@ -53,6 +49,7 @@ type Connection interface {
 	Context() Context
 
 	bindVar(i int, field string) string
+	setError(err error)
 	StreamRecords(sql string) (<-chan map[string]interface{}, error)
 	GetDDL(string) (string, error)
 	GetSchemata(string) (Schema, error)
@@ -67,6 +64,7 @@ type Connection interface {
 	RunAnalysis(string, map[string]interface{}) (Dataset, error)
 	RunAnalysisTable(string, ...string) (Dataset, error)
 	RunAnalysisField(string, string, ...string) (Dataset, error)
+	RunRoutine(string, map[string]interface{}) (Dataset, error)
 }
 
 // BaseConn is a database connection
@@ -80,15 +78,22 @@ type BaseConn struct {
 	template   Template
 	schemata   Schemata
 	properties map[string]string
+	err        error // of GetConn, returned by Connect
 }
 
 // Column represents a schemata column
 type Column struct {
-	Position int64  `json:"position"`
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	stats    ColumnStats
-	colType  *sql.ColumnType
+	Position      int64  `json:"position"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Length        int    `json:"length,omitempty"`    // of strings, 0 if unknown
+	Precision     int    `json:"precision,omitempty"` // of numbers, 0 if unknown
+	Scale         int    `json:"scale,omitempty"`
+	Nullable      bool   `json:"nullable"`
+	nullableKnown bool   // whether Nullable comes from the source
+	floating      bool   // of floating point values (float, double), not exact decimals
+	stats         ColumnStats
+	colType       *sql.ColumnType
 }
 
 // Table represents a schemata table
@@ -121,46 +126,40 @@ type Template struct {
 	GeneralTypeMap map[string]string `yaml:"general_type_map"`
 	NativeTypeMap  map[string]string `yaml:"native_type_map"`
 	Variable       map[string]string
+	Routine        map[string]string
+	ErrorFilter    map[string]string `yaml:"error_filter"`
+	sources        map[string]string // the file of each `section.key`
 }
 
-// GetConn return the most proper connection for a given database
+// GetConn return the most proper connection for a given database.
+// The connection type is resolved from the URL scheme, see RegisterConnection
 func GetConn(URL string) Connection {
 	var conn Connection
 
-	if strings.HasPrefix(URL, "postgres") {
-		if isRedshift(URL) {
-			conn = &RedshiftConn{URL: URL}
-		} else {
-			conn = &PostgresConn{URL: URL}
-		}
-	} else if strings.HasPrefix(URL, "mysql:") {
-		conn = &MySQLConn{URL: URL}
-	} else if strings.HasPrefix(URL, "sqlserver:") {
-		conn = &BaseConn{URL: URL, Type: "sqlserver"}
-	} else if strings.HasPrefix(URL, "oracle:") {
-		conn = &OracleConn{URL: URL}
-	} else if strings.HasPrefix(URL, "file:") {
-		conn = &BaseConn{URL: URL, Type: "sqlite3"}
+	// resolve `${ENV_VAR}` / `${file:/path}` references
+	URL, err := ResolveSecrets(URL)
+	RegisterURLSecrets(URL)
+
+	if reg, ok := getConnRegistration(URL); ok {
+		conn = reg.factory(URL)
 	} else {
 		conn = &BaseConn{URL: URL}
 	}
 
 	// Init
 	conn.Init()
+	if err != nil {
+		// the connection fails with the unresolved references
+		conn.setError(Error(err, "Could not resolve secrets in URL"))
+	}
 
 	return conn
 }
 
 func getDriverName(name string) (driverName string) {
 	driverName = name
-	if driverName == "redshift" {
-		driverName = "postgres"
-	}
-	if driverName == "oracle" {
-		driverName = "godror"
-	}
-	if driverName == "sqlserver" {
-		driverName = "mssql"
+	if driver, ok := GetConnDriver(name); ok {
+		driverName = driver.DriverName
 	}
 	return
 }
@@ -168,6 +167,17 @@ func getDriverName(name string) (driverName string) {
 // Init initiates the connection object
 func (conn *BaseConn) Init() (err error) {
 	conn.LoadYAML()
+
+	// default bulk capabilities from the registered driver
+	if driver, ok := GetConnDriver(conn.Type); ok {
+		if conn.GetProp("allow_bulk_import") == "" {
+			conn.SetProp("allow_bulk_import", cast.ToString(driver.BulkImport))
+		}
+		if conn.GetProp("allow_bulk_export") == "" {
+			conn.SetProp("allow_bulk_export", cast.ToString(driver.BulkExport))
+		}
+	}
+
 	connCtx, cancel := context.WithCancel(context.Background())
 	conn.context.ctx = connCtx
 	conn.context.cancel = cancel
@@ -220,8 +230,17 @@ func (conn *BaseConn) Kill() error {
 	return nil
 }
 
+// setError sets the error returned by Connect
+func (conn *BaseConn) setError(err error) {
+	conn.err = err
+}
+
 // Connect connects to the database
 func (conn *BaseConn) Connect() error {
+	if conn.err != nil {
+		return conn.err
+	}
+
 	conn.schemata = Schemata{
 		Schemas: map[string]Schema{},
 		Tables:  map[string]*Table{},
@@ -239,7 +258,9 @@ func (conn *BaseConn) Connect() error {
 	}
 
 	conn.db = db
-	conn.properties = map[string]string{}
+	if conn.properties == nil {
+		conn.properties = map[string]string{}
+	}
 
 	err = conn.db.Ping()
 	if err != nil {
@@ -264,102 +285,21 @@ func (conn *BaseConn) GetGormConn() (*gorm.DB, error) {
 
 // GetTemplateValue returns the value of the path
 func (conn *BaseConn) GetTemplateValue(path string) (value string) {
-
-	prefixes := map[string]map[string]string{
-		"core.":             conn.template.Core,
-		"analysis.":         conn.template.Analysis,
-		"function.":         conn.template.Function,
-		"metadata.":         conn.template.Metadata,
-		"general_type_map.": conn.template.GeneralTypeMap,
-		"native_type_map.":  conn.template.NativeTypeMap,
-		"variable.":         conn.template.Variable,
-	}
-
-	for prefix, dict := range prefixes {
-		if strings.HasPrefix(path, prefix) {
-			key := strings.Replace(path, prefix, "", 1)
-			value = dict[key]
-			break
-		}
-	}
-
-	return value
+	return conn.template.Get(path)
 }
 
-// LoadYAML loads the approriate yaml template
+// LoadYAML loads the approriate yaml template, with the overrides
+// of the `templates_dir` property or TemplatesDir
 func (conn *BaseConn) LoadYAML() error {
-	conn.template = Template{
-		Core:           map[string]string{},
-		Metadata:       map[string]string{},
-		Analysis:       map[string]string{},
-		Function:       map[string]string{},
-		GeneralTypeMap: map[string]string{},
-		NativeTypeMap:  map[string]string{},
-		Variable:       map[string]string{},
-	}
-
-	_, filename, _, _ := runtime.Caller(1)
-	pkgerRead := func(name string) (TemplateBytes []byte, err error) {
-		TemplateFile, err := pkger.Open(path.Join(path.Dir(filename), "templates", name))
-		if err != nil {
-			return nil, Error(err, "pkger.Open()"+path.Join(path.Dir(filename), "templates", name))
-		}
-		TemplateBytes, err = ioutil.ReadAll(TemplateFile)
-		return TemplateBytes, err
-	}
-
-	baseTemplateBytes, err := pkgerRead("base.yaml")
-	if err != nil {
-		return Error(err, "box.FindString('base.yaml')")
-	}
-
-	if err := yaml.Unmarshal([]byte(baseTemplateBytes), &conn.template); err != nil {
-		return Error(err, "yaml.Unmarshal")
+	overrideDir := conn.GetProp("templates_dir")
+	if overrideDir == "" {
+		overrideDir = TemplatesDir
 	}
 
-	templateBytes, err := pkgerRead(conn.Type + ".yaml")
+	template, err := LoadTemplate(conn.Type, overrideDir)
+	conn.template = template
 	if err != nil {
-		return Error(err, "box.FindString('.yaml') for "+conn.Type)
-	}
-
-	template := Template{}
-	err = yaml.Unmarshal([]byte(templateBytes), &template)
-	if err != nil {
-		return Error(err, "yaml.Unmarshal")
-	}
-
-	// jsonMap := make(map[string]interface{})
-	// println(templateBytes)
-	// err = json.Unmarshal([]byte(templateBytes), &jsonMap)
-	// val, err := j.Search("general_type_map", jsonMap)
-	// PrintV(val)
-
-	for key, val := range template.Core {
-		conn.template.Core[key] = val
-	}
-
-	for key, val := range template.Analysis {
-		conn.template.Analysis[key] = val
-	}
-
-	for key, val := range template.Function {
-		conn.template.Function[key] = val
-	}
-
-	for key, val := range template.Metadata {
-		conn.template.Metadata[key] = val
-	}
-
-	for key, val := range template.GeneralTypeMap {
-		conn.template.GeneralTypeMap[key] = val
-	}
-
-	for key, val := range template.NativeTypeMap {
-		conn.template.NativeTypeMap[key] = val
-	}
-
-	for key, val := range template.Variable {
-		conn.template.Variable[key] = val
+		return Error(err, "Could not load template for "+conn.Type)
 	}
 
 	return nil
@@ -384,17 +324,18 @@ func processVal(val interface{}) interface{} {
 	case int64:
 		nVal = cast.ToInt64(val)
 	case float32:
-		nVal = cast.ToFloat32(val)
+		// shortest representation, 0.1 and not 0.10000000149
+		nVal, _ = strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
 	case float64:
-		nVal = cast.ToString(val)
+		nVal = v
 	case godror.Number:
-		nVal = ParseString(cast.ToString(val))
+		nVal = parseDriverString(string(v))
 	case bool:
 		nVal = cast.ToBool(val)
 	case []uint8:
-		nVal = ParseString(cast.ToString(val))
+		nVal = parseDriverString(string(v))
 	default:
-		nVal = ParseString(cast.ToString(val))
+		nVal = parseDriverString(cast.ToString(val))
 		_ = fmt.Sprint(v)
 		// fmt.Printf("%T\n", val)
 	}
@@ -402,10 +343,64 @@ func processVal(val interface{}) interface{} {
 
 }
 
-func processRow(row []interface{}) []interface{} {
+// parseDriverString parses a value returned as text by a driver (numeric,
+// NUMBER, decimal). Non-integer numbers are kept exact, as a Decimal.
+func parseDriverString(s string) interface{} {
+	val := driverInferOptions.ParseString(s)
+	if _, ok := val.(float64); ok {
+		if d, err := NewDecimal(s); err == nil {
+			return d
+		}
+	}
+	return val
+}
+
+// processColumnVal processes a value of a column. Binary, json and
+// array values are kept from being parsed (see processVal).
+func processColumnVal(val interface{}, col Column) interface{} {
+	switch col.Type {
+	case "binary":
+		if _, ok := val.([]uint8); ok {
+			// already a copy, made by the scan
+			return val
+		}
+	case "json":
+		switch v := val.(type) {
+		case []uint8:
+			return string(v)
+		case string:
+			return v
+		}
+	case "array":
+		s, ok := val.(string)
+		if b, isBytes := val.([]uint8); isBytes {
+			s, ok = string(b), true
+		}
+		if ok && (strings.HasPrefix(s, "{") || strings.Contains(s, "]={")) {
+			// postgres array, as a JSON array
+			elemType := ""
+			if col.colType != nil {
+				elemType = strings.TrimPrefix(strings.ToLower(col.colType.DatabaseTypeName()), "_")
+			}
+			if arr, err := pgArrayToJSON(s, elemType); err == nil {
+				return arr
+			}
+		}
+		if ok {
+			return s
+		}
+	}
+	return processVal(val)
+}
+
+func processRow(row []interface{}, columns []Column) []interface{} {
 	// Ensure usable types
 	for i, val := range row {
-		row[i] = processVal(val)
+		if i < len(columns) {
+			row[i] = processColumnVal(val, columns[i])
+		} else {
+			row[i] = processVal(val)
+		}
 	}
 	return row
 }
@@ -489,16 +484,17 @@ func (conn *BaseConn) StreamRowsContext(ctx context.Context, sql string) (ds Dat
 		return ds, errors.New("Empty Query")
 	}
 
-	queryCtx, queryCancel := context.WithCancel(ctx)
-	result, err := conn.db.QueryxContext(queryCtx, sql)
+	// the query is cancelled with the stream
+	ds = NewDatastreamContext(ctx, nil)
+	result, err := conn.db.QueryxContext(ds.Context(), sql)
 	if err != nil {
-		queryCancel()
+		ds.Cancel()
 		return ds, Error(err, "SQL Error for:\n"+sql)
 	}
 
 	colTypes, err := result.ColumnTypes()
 	if err != nil {
-		queryCancel()
+		ds.Cancel()
 		return ds, Error(err, "result.ColumnTypes()")
 	}
 
@@ -508,32 +504,31 @@ func (conn *BaseConn) StreamRowsContext(ctx context.Context, sql string) (ds Dat
 	conn.Data.Rows = [][]interface{}{}
 	conn.Data.setColumns(colTypes, conn.template.NativeTypeMap)
 
-	ds = Datastream{
-		Columns: conn.Data.Columns,
-		Rows:    make(chan []interface{}),
-		context: Context{queryCtx, queryCancel},
-	}
+	ds.Columns = conn.Data.Columns
 
 	go func() {
+		// Ensure that at the end of the loop we close the channel!
+		defer ds.Close()
+		defer result.Close()
+
 		for result.Next() {
 			// add row
 			row, err := result.SliceScan()
 			if err != nil {
-				LogError(err)
-				break
+				ds.SetError(Error(err, "result.SliceScan()"))
+				return
 			}
-			row = processRow(row)
+			row = processRow(row, ds.Columns)
 
-			select {
-			case <-ds.context.ctx.Done():
-				break
-			default:
-				ds.Rows <- row
+			if !ds.push(row) {
+				ds.SetError(Error(ds.Context().Err(), "stream cancelled"))
+				return
 			}
+		}
 
+		if err := result.Err(); err != nil {
+			ds.SetError(Error(err, "Error streaming rows for:\n"+sql))
 		}
-		// Ensure that at the end of the loop we close the channel!
-		close(ds.Rows)
 	}()
 
 	return ds, nil
@@ -552,6 +547,10 @@ func (conn *BaseConn) Query(sql string) (Dataset, error) {
 	data.SQL = sql
 	data.Duration = conn.Data.Duration // Collect does not time duration
 
+	if err := ds.Err(); err != nil {
+		return data, Error(err, "Could not collect rows for:\n"+sql)
+	}
+
 	return data, nil
 }
 
@@ -567,6 +566,10 @@ func (conn *BaseConn) QueryContext(ctx context.Context, sql string) (Dataset, er
 	data.SQL = sql
 	data.Duration = conn.Data.Duration // Collect does not time duration
 
+	if err := ds.Err(); err != nil {
+		return data, Error(err, "Could not collect rows for:\n"+sql)
+	}
+
 	return data, nil
 }
 
@@ -696,6 +699,13 @@ func getMetadataTableFName(conn *BaseConn, template string, tableFName string) s
 	return sql
 }
 
+// matchErrorFilter returns true if the message of the driver error
+// (not the SQL it is wrapped with) contains the `error_filter` entry
+func (conn *BaseConn) matchErrorFilter(name string, err error) bool {
+	filter := conn.template.ErrorFilter[name]
+	return err != nil && filter != "" && strings.Contains(stacktrace.RootCause(err).Error(), filter)
+}
+
 // DropTable drops given table.
 func (conn *BaseConn) DropTable(tableNames ...string) (err error) {
 
@@ -703,8 +713,7 @@ func (conn *BaseConn) DropTable(tableNames ...string) (err error) {
 		sql := R(conn.template.Core["drop_table"], "table", tableName)
 		_, err = conn.Query(sql)
 		if err != nil {
-			errIgnoreWord := conn.template.Variable["error_ignore_drop_table"]
-			if !(errIgnoreWord != "" && strings.Contains(cast.ToString(err), errIgnoreWord)) {
+			if !conn.matchErrorFilter("table_not_exist", err) {
 				return Error(err, "Error for "+sql)
 			} else {
 				log.Debug(F("table %s does not exist", tableName))
@@ -723,8 +732,7 @@ func (conn *BaseConn) DropView(viewNames ...string) (err error) {
 		sql := R(conn.template.Core["drop_view"], "view", viewName)
 		_, err = conn.Query(sql)
 		if err != nil {
-			errIgnoreWord := conn.template.Variable["error_ignore_drop_view"]
-			if !(errIgnoreWord != "" && strings.Contains(cast.ToString(err), errIgnoreWord)) {
+			if !conn.matchErrorFilter("table_not_exist", err) {
 				return Error(err, "Error for "+sql)
 			} else {
 				log.Debug(F("view %s does not exist", viewName))
@@ -792,9 +800,17 @@ func (conn *BaseConn) GetSchemata(schemaName string) (Schema, error) {
 		}
 
 		column := Column{
-			Position: cast.ToInt64(rec["position"]),
-			Name:     strings.ToLower(cast.ToString(rec["column_name"])),
-			Type:     cast.ToString(rec["data_type"]),
+			Position:  cast.ToInt64(rec["position"]),
+			Name:      strings.ToLower(cast.ToString(rec["column_name"])),
+			Type:      cast.ToString(rec["data_type"]),
+			Length:    cast.ToInt(rec["data_length"]),
+			Precision: cast.ToInt(rec["data_precision"]),
+			Scale:     cast.ToInt(rec["data_scale"]),
+		}
+
+		if nullable, ok := rec["nullable"]; ok && nullable != nil {
+			column.Nullable = castNullable(nullable)
+			column.nullableKnown = true
 		}
 
 		table.Columns = append(table.Columns, column)
@@ -810,6 +826,16 @@ func (conn *BaseConn) GetSchemata(schemaName string) (Schema, error) {
 	return schema, nil
 }
 
+// castNullable returns whether a nullable metadata value is true
+// (YES, Y, true or 1)
+func castNullable(val interface{}) bool {
+	switch strings.ToUpper(cast.ToString(val)) {
+	case "YES", "Y", "TRUE", "T", "1":
+		return true
+	}
+	return false
+}
+
 // RunAnalysis runs an analysis
 func (conn *BaseConn) RunAnalysis(analysisName string, values map[string]interface{}) (Dataset, error) {
 	sql := Rm(
@@ -819,6 +845,16 @@ func (conn *BaseConn) RunAnalysis(analysisName string, values map[string]interfa
 	return conn.Query(sql)
 }
 
+// RunRoutine runs a routine
+func (conn *BaseConn) RunRoutine(routineName string, values map[string]interface{}) (Dataset, error) {
+	routine, ok := conn.template.Routine[routineName]
+	if !ok {
+		return Dataset{}, errors.New(F("Routine '%s' not found for %s", routineName, conn.Type))
+	}
+	sql := Rm(routine, values)
+	return conn.Query(sql)
+}
+
 // RunAnalysisTable runs a table level analysis
 func (conn *BaseConn) RunAnalysisTable(analysisName string, tableFNames ...string) (Dataset, error) {
 
@@ -986,17 +1022,32 @@ func (conn *BaseConn) InsertStream(tableFName string, ds Datastream) (count uint
 	tx := conn.db.MustBegin()
 	for row := range ds.Rows {
 		count++
+		for i, val := range row {
+			row[i] = normalizeTime(val, ds.column(i).Type)
+		}
+
 		// Do insert
 		_, err := tx.Exec(insertTemplate, row...)
 		if err != nil {
 			tx.Rollback()
+			ds.Cancel()
 			return count, Error(
 				err,
 				F("Insert: %s\nFor Row: %#v", insertTemplate, row),
 			)
 		}
 	}
-	tx.Commit()
+
+	// do not commit a partial load
+	if err = ds.Err(); err != nil {
+		tx.Rollback()
+		return count, Error(err, "Upstream stream failed, rolled back inserts into "+tableFName)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return count, Error(err, "tx.Commit()")
+	}
 
 	return count, nil
 }
@@ -1004,10 +1055,26 @@ func (conn *BaseConn) InsertStream(tableFName string, ds Datastream) (count uint
 // GenerateDDL genrate a DDL based on a dataset
 func (conn *BaseConn) GenerateDDL(tableFName string, data Dataset) (string, error) {
 
-	data.InferColumnTypes()
+	// the source metadata (type, length, precision, scale, nullable)
+	// is preferred over the sampled stats
+	sample := Dataset{Columns: data.Columns, Rows: data.Rows}
+	sample.InferColumnTypes()
 	columnsDDL := []string{}
 
-	for _, col := range data.Columns {
+	for i, col := range sample.Columns {
+		if i < len(data.Columns) {
+			srcCol := data.Columns[i]
+			if _, ok := conn.template.GeneralTypeMap[srcCol.Type]; ok {
+				col.Type = srcCol.Type
+			}
+			col.Length = srcCol.Length
+			col.Precision = srcCol.Precision
+			col.Scale = srcCol.Scale
+			col.Nullable = srcCol.Nullable
+			col.nullableKnown = srcCol.nullableKnown
+			col.colType = srcCol.colType
+		}
+
 		// convert from general type to native type
 		nativeType, ok := conn.template.GeneralTypeMap[col.Type]
 		if !ok {
@@ -1024,7 +1091,9 @@ func (conn *BaseConn) GenerateDDL(tableFName string, data Dataset) (string, erro
 		if strings.HasSuffix(nativeType, "()") {
 			length := col.stats.maxLen*2
 			if col.Type == "string" {
-				if length < 255 {
+				if col.Length > 0 {
+					length = col.Length
+				} else if length < 255 {
 					length = 255
 				}
 				nativeType = strings.ReplaceAll(
@@ -1033,7 +1102,9 @@ func (conn *BaseConn) GenerateDDL(tableFName string, data Dataset) (string, erro
 					F("(%d)", length),
 				)
 			} else if col.Type == "integer" {
-				if length < 10 {
+				if col.Precision > 0 {
+					length = col.Precision
+				} else if length < 10 {
 					length = 10
 				}
 				nativeType = strings.ReplaceAll(
@@ -1046,11 +1117,16 @@ func (conn *BaseConn) GenerateDDL(tableFName string, data Dataset) (string, erro
 			length := col.stats.maxLen*2
 			scale := col.stats.maxDecLen*2
 			if col.Type == "decimal" {
-				if length < 10 {
-					length = 10
-				}
-				if scale < 4 {
-					scale = 4
+				if col.Precision > 0 {
+					length = col.Precision
+					scale = col.Scale
+				} else {
+					if length < 10 {
+						length = 10
+					}
+					if scale < 4 {
+						scale = 4
+					}
 				}
 				nativeType = strings.ReplaceAll(
 					nativeType,
@@ -1058,6 +1134,18 @@ func (conn *BaseConn) GenerateDDL(tableFName string, data Dataset) (string, erro
 					F("(%d,%d)", length, scale),
 				)
 			}
+		} else if strings.HasSuffix(nativeType, "[]") && col.colType != nil {
+			// postgres arrays keep their element type, e.g. int4[]
+			if srcType := strings.ToLower(col.colType.DatabaseTypeName()); strings.HasPrefix(srcType, "_") {
+				nativeType = strings.TrimPrefix(srcType, "_") + "[]"
+			}
+		} else if !strings.Contains(nativeType, "(") {
+			// unsized native type, sized only with the source metadata
+			if col.Type == "string" && col.Length > 0 {
+				nativeType = F("%s(%d)", nativeType, col.Length)
+			} else if col.Type == "decimal" && col.Precision > 0 {
+				nativeType = F("%s(%d,%d)", nativeType, col.Precision, col.Scale)
+			}
 		}
 
 		columnDDL := F(
@@ -1065,6 +1153,9 @@ func (conn *BaseConn) GenerateDDL(tableFName string, data Dataset) (string, erro
 			col.Name,
 			nativeType,
 		)
+		if col.nullableKnown && !col.Nullable {
+			columnDDL = columnDDL + " NOT NULL"
+		}
 		columnsDDL = append(columnsDDL, columnDDL)
 	}
 
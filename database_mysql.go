@@ -44,11 +44,6 @@ func (conn *MySQLConn) Init() error {
 		Type: "mysql",
 	}
 
-	// Turn off Bulk export for now
-	// the LoadDataOutFile needs special circumstances
-	conn.BaseConn.SetProp("allow_bulk_export", "false")
-	conn.BaseConn.SetProp("allow_bulk_import", "true")
-
 	return conn.BaseConn.Init()
 }
 
@@ -96,6 +91,27 @@ func (conn *MySQLConn) BulkImportStream(tableFName string, ds Datastream) (count
 	return conn.LoadDataInFile(tableFName, ds)
 }
 
+// mysqlLoadColumns returns the column clause of LOAD DATA, if there are
+// binary columns: their values are hex in the CSV stream (see NewCsvReader)
+// and are read into user variables to be decoded with UNHEX
+func mysqlLoadColumns(columns []Column) string {
+	names := make([]string, len(columns))
+	sets := []string{}
+	for i, col := range columns {
+		name := "`" + strings.ReplaceAll(col.Name, "`", "``") + "`"
+		names[i] = name
+		if col.Type == "binary" {
+			names[i] = F("@col_%d", i+1)
+			sets = append(sets, F("%s = UNHEX(%s)", name, names[i]))
+		}
+	}
+
+	if len(sets) == 0 {
+		return ""
+	}
+	return F(" (%s) SET %s", strings.Join(names, ", "), strings.Join(sets, ", "))
+}
+
 // LoadDataOutFile Bulk Export
 // Possible error: ERROR 1227 (42000) at line 1: Access denied; you need (at least one of) the FILE privilege(s) for this operation
 // File priviledge needs to be granted to user
@@ -109,6 +125,7 @@ func (conn *MySQLConn) LoadDataOutFile(sql string) (stdOutReader io.Reader, err
 	}
 
 	password, _ := url.User.Password()
+	RegisterSecret(password)
 	host := strings.ReplaceAll(url.Host, ":"+url.Port(), "")
 	database := strings.ReplaceAll(url.Path, "/", "")
 	query := R(
@@ -134,7 +151,7 @@ func (conn *MySQLConn) LoadDataOutFile(sql string) (stdOutReader io.Reader, err
 		err := proc.Run()
 		if err != nil {
 			// bytes, _ := proc.CombinedOutput()
-			cmdStr := strings.ReplaceAll(strings.Join(proc.Args, " "), password, "****")
+			cmdStr := Redact(strings.Join(proc.Args, " "))
 			println(Error(
 				err,
 				F(
@@ -158,11 +175,18 @@ func (conn *MySQLConn) LoadDataInFile(tableFName string, ds Datastream) (count u
 	}
 
 	password, _ := url.User.Password()
+	RegisterSecret(password)
 	host := strings.ReplaceAll(url.Host, ":"+url.Port(), "")
 	database := strings.ReplaceAll(url.Path, "/", "")
 
-	loadQuery := R(`LOAD DATA LOCAL INFILE '/dev/stdin' INTO TABLE {table} FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '"' IGNORE 1 LINES;`, "table", tableFName)
-	proc := exec.Command(
+	loadQuery := R(
+		`LOAD DATA LOCAL INFILE '/dev/stdin' INTO TABLE {table} FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '"' IGNORE 1 LINES{columns};`,
+		"table", tableFName,
+		"columns", mysqlLoadColumns(ds.Columns),
+	)
+	// the process is killed (and the load aborted) if the stream fails
+	proc := exec.CommandContext(
+		ds.Context(),
 		"mysql",
 		"--local-infile=1",
 		"-h", host,
@@ -177,8 +201,10 @@ func (conn *MySQLConn) LoadDataInFile(tableFName string, ds Datastream) (count u
 	proc.Stdin = ds.NewCsvReader(0)
 
 	err = proc.Run()
-	if err != nil {
-		cmdStr := strings.ReplaceAll(strings.Join(proc.Args, " "), password, "****")
+	if ds.Err() != nil {
+		return ds.count, Error(ds.Err(), "Upstream stream failed, aborted the load into "+tableFName)
+	} else if err != nil {
+		cmdStr := Redact(strings.Join(proc.Args, " "))
 		err = Error(
 			err,
 			F(
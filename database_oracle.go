@@ -25,8 +25,6 @@ func (conn *OracleConn) Init() error {
 		Type: "oracle",
 	}
 
-	conn.BaseConn.SetProp("allow_bulk_import", "false")
-
 	return conn.BaseConn.Init()
 }
 
@@ -78,6 +76,7 @@ func (conn *OracleConn) SQLLoad(tableFName string, ds Datastream) (count uint64,
 	}
 
 	password, _ := url.User.Password()
+	RegisterSecret(password)
 	hostPort := url.Host
 	sid := strings.ReplaceAll(url.Path, "/", "")
 	credHost := F(
@@ -85,7 +84,9 @@ func (conn *OracleConn) SQLLoad(tableFName string, ds Datastream) (count uint64,
 		password, hostPort, sid,
 	)
 
-	proc := exec.Command(
+	// the process is killed (and the load aborted) if the stream fails
+	proc := exec.CommandContext(
+		ds.Context(),
 		"sqlldr",
 		credHost,
 		"control="+ctlPath,
@@ -104,9 +105,11 @@ func (conn *OracleConn) SQLLoad(tableFName string, ds Datastream) (count uint64,
 	// Delete ctrl file
 	os.Remove(ctlPath)
 
-	if err != nil {
-		cmdStr := strings.ReplaceAll(strings.Join(proc.Args, " "), password, "****")
-		println(stdout.String())
+	if ds.Err() != nil {
+		err = Error(ds.Err(), "Upstream stream failed, aborted the load into "+tableFName)
+	} else if err != nil {
+		cmdStr := Redact(strings.Join(proc.Args, " "))
+		println(Redact(stdout.String()))
 		err = Error(
 			err,
 			F(
@@ -2,6 +2,8 @@ package gxutil
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
@@ -24,16 +26,13 @@ func (conn *PostgresConn) Init() error {
 		Type: "postgres",
 	}
 
-	// Turn off Bulk export for now
-	// the CopyToStdout function frequently produces error `read |0: file already closed`
-	conn.BaseConn.SetProp("allow_bulk_export", "false")
-
 	return conn.BaseConn.Init()
 }
 
 // CopyToStdout Copy TO STDOUT
 func (conn *PostgresConn) CopyToStdout(sql string) (stdOutReader io.Reader, err error) {
 	var stderr bytes.Buffer
+	RegisterURLSecrets(conn.URL)
 	copyQuery := F(`\copy ( %s ) TO STDOUT WITH CSV HEADER DELIMITER ',' QUOTE '"' ESCAPE '"'`, sql)
 	copyQuery = strings.ReplaceAll(copyQuery, "\n", " ")
 
@@ -44,9 +43,9 @@ func (conn *PostgresConn) CopyToStdout(sql string) (stdOutReader io.Reader, err
 	go func() {
 		if proc.Run() != nil {
 			// bytes, _ := proc.CombinedOutput()
-			cmdStr := strings.ReplaceAll(strings.Join(proc.Args, " "), conn.URL, "$DBURL")
+			cmdStr := Redact(strings.Join(proc.Args, " "))
 			println("COPY FROM Command -> ", cmdStr)
-			println("COPY FROM Error   -> ", stderr.String())
+			println("COPY FROM Error   -> ", Redact(stderr.String()))
 		}
 	}()
 
@@ -86,19 +85,47 @@ func (conn *PostgresConn) BulkImportStream(tableFName string, ds Datastream) (co
 
 	stmt, err := txn.Prepare(pq.CopyInSchema(schema, table, columns...))
 	if err != nil {
+		txn.Rollback()
 		return count, Error(err, fmt.Sprint(table, columns))
 	}
 
+	// arrays are streamed as JSON
+	arrayCols := []int{}
+	for i, col := range ds.Columns {
+		if col.Type == "array" {
+			arrayCols = append(arrayCols, i)
+		}
+	}
+
 	for row := range ds.Rows {
 		count++
+		for _, i := range arrayCols {
+			if s, ok := row[i].(string); ok && strings.HasPrefix(s, "[") {
+				row[i], err = jsonToPgArray(s)
+				if err != nil {
+					txn.Rollback()
+					ds.Cancel()
+					return count, err
+				}
+			}
+		}
+
 		// Do insert
 		_, err := stmt.Exec(row...)
 		if err != nil {
 			txn.Rollback()
+			ds.Cancel()
 			return count, Error(err, "\n"+fmt.Sprint(row))
 		}
 	}
 
+	// do not commit a partial load
+	if err = ds.Err(); err != nil {
+		stmt.Close()
+		txn.Rollback()
+		return count, Error(err, "Upstream stream failed, rolled back copy into "+tableFName)
+	}
+
 	_, err = stmt.Exec()
 	if err != nil {
 		txn.Rollback()
@@ -117,3 +144,164 @@ func (conn *PostgresConn) BulkImportStream(tableFName string, ds Datastream) (co
 
 	return count, nil
 }
+
+// pgArrayParser parses a postgres array literal, e.g. `{1,NULL,"a b"}`
+type pgArrayParser struct {
+	s        string
+	pos      int
+	elemType string // int4, text, bool...
+}
+
+// pgArrayToJSON converts a postgres array literal to a JSON array.
+// The elements of numeric and bool arrays are not quoted.
+func pgArrayToJSON(literal string, elemType string) (string, error) {
+	s := literal
+	if i := strings.Index(s, "]={"); i > -1 && strings.HasPrefix(s, "[") {
+		// explicit bounds, e.g. `[0:1]={1,2}`
+		s = s[i+2:]
+	}
+
+	p := &pgArrayParser{s: s, elemType: elemType}
+	values, err := p.parseArray()
+	if err == nil && p.pos != len(s) {
+		err = errors.New("unexpected characters after the array")
+	}
+	if err != nil {
+		return "", Error(err, "Invalid postgres array: "+literal)
+	}
+
+	arrBytes, err := json.Marshal(values)
+	return string(arrBytes), err
+}
+
+func (p *pgArrayParser) parseArray() ([]interface{}, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+		return nil, errors.New(F("expected '{' at %d", p.pos))
+	}
+	p.pos++
+
+	values := []interface{}{}
+	if p.pos < len(p.s) && p.s[p.pos] == '}' {
+		p.pos++
+		return values, nil
+	}
+
+	for p.pos < len(p.s) {
+		var val interface{}
+		var err error
+		switch p.s[p.pos] {
+		case '{':
+			val, err = p.parseArray()
+		case '"':
+			var s string
+			s, err = p.parseQuoted()
+			val = p.elemValue(s)
+		default:
+			end := p.pos
+			for end < len(p.s) && p.s[end] != ',' && p.s[end] != '}' {
+				end++
+			}
+			token := p.s[p.pos:end]
+			p.pos = end
+			if strings.EqualFold(token, "NULL") {
+				val = nil
+			} else {
+				val = p.elemValue(token)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+
+		if p.pos >= len(p.s) {
+			break
+		} else if p.s[p.pos] == '}' {
+			p.pos++
+			return values, nil
+		} else if p.s[p.pos] != ',' {
+			return nil, errors.New(F("expected ',' at %d", p.pos))
+		}
+		p.pos++
+	}
+
+	return nil, errors.New("unterminated array")
+}
+
+func (p *pgArrayParser) parseQuoted() (string, error) {
+	var sb strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; c {
+		case '\\':
+			p.pos++
+			if p.pos < len(p.s) {
+				sb.WriteByte(p.s[p.pos])
+			}
+		case '"':
+			p.pos++
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated quoted element")
+}
+
+// elemValue returns the JSON value of an array element
+func (p *pgArrayParser) elemValue(s string) interface{} {
+	switch p.elemType {
+	case "int2", "int4", "int8", "float4", "float8", "numeric":
+		if d, err := NewDecimal(s); err == nil {
+			return json.Number(d)
+		}
+	case "bool":
+		if s == "t" || s == "f" {
+			return s == "t"
+		}
+	case "json", "jsonb":
+		if json.Valid([]byte(s)) {
+			return json.RawMessage(s)
+		}
+	}
+	return s
+}
+
+// jsonToPgArray converts a JSON array to a postgres array literal
+func jsonToPgArray(s string) (string, error) {
+	values := []interface{}{}
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	err := decoder.Decode(&values)
+	if err != nil {
+		return "", Error(err, "Invalid JSON array: "+s)
+	}
+	return pgArrayLiteral(values), nil
+}
+
+func pgArrayLiteral(values []interface{}) string {
+	quote := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+
+	items := make([]string, len(values))
+	for i, val := range values {
+		switch v := val.(type) {
+		case nil:
+			items[i] = "NULL"
+		case []interface{}:
+			items[i] = pgArrayLiteral(v)
+		case json.Number:
+			items[i] = v.String()
+		case bool:
+			items[i] = cast.ToString(v)
+		case string:
+			items[i] = quote(v)
+		default:
+			// objects, as JSON
+			objBytes, _ := json.Marshal(v)
+			items[i] = quote(string(objBytes))
+		}
+	}
+	return "{" + strings.Join(items, ",") + "}"
+}
@@ -2,7 +2,6 @@ package gxutil
 
 import (
 	"bytes"
-	"context"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -22,6 +21,12 @@ type RedshiftConn struct {
 
 // Init initiates the object
 func (conn *RedshiftConn) Init() error {
+	// the `redshift` scheme is registered for explicit use,
+	// but the driver only understands `postgres`
+	if strings.HasPrefix(conn.URL, "redshift:") {
+		conn.URL = "postgres:" + strings.TrimPrefix(conn.URL, "redshift:")
+	}
+
 	conn.BaseConn = BaseConn{
 		URL:  conn.URL,
 		Type: "redshift",
@@ -63,6 +68,8 @@ func (conn *RedshiftConn) Unload(sql string) (s3Path string, err error) {
 	s3Path = F("sling/stream/%s.csv", cast.ToString(Now()))
 	AwsID := os.Getenv("AWS_ACCESS_KEY_ID")
 	AwsAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	RegisterSecret(AwsID)
+	RegisterSecret(AwsAccessKey)
 
 	txn := conn.Db().MustBegin()
 
@@ -79,9 +86,7 @@ func (conn *RedshiftConn) Unload(sql string) (s3Path string, err error) {
 	)
 	_, err = txn.Exec(unloadSQL)
 	if err != nil {
-		cleanSQL := strings.ReplaceAll(unloadSQL, AwsID, "*****")
-		cleanSQL = strings.ReplaceAll(cleanSQL, AwsAccessKey, "*****")
-		return s3Path, Error(err, "SQL Error:\n"+cleanSQL)
+		return s3Path, Error(err, "SQL Error:\n"+unloadSQL)
 	}
 
 	Log(F("Unloaded to s3://%s/%s", s3.Bucket, s3Path))
@@ -110,31 +115,50 @@ func (conn *RedshiftConn) BulkExportStream(sql string) (ds Datastream, err error
 		return ds, Error(err, "Could not s3.List for "+s3Path+"/")
 	}
 
-	mainCtx, cancel := context.WithCancel(context.Background())
-	ds = Datastream{
-		Rows:    make(chan []interface{}, 100000), // 100000 row limit in memory
-		context: Context{mainCtx, cancel},
+	ds = NewDatastream(nil)
+	ds.Rows = make(chan []interface{}, 100000) // 100000 row limit in memory
+
+	if len(s3PartPaths) == 0 {
+		ds.Close()
+		return ds, errors.New("No unloaded files found in s3://" + s3.Bucket + "/" + s3Path)
 	}
 
 	decompressAndStream := func(s3PartPath string, dsMain *Datastream) {
 		// limit concurent workers
 		for {
+			mux.Lock()
 			if workers < maxWorkers {
 				workers++
+				mux.Unlock()
 				break
 			}
+			mux.Unlock()
 			time.Sleep(100 * time.Millisecond)
 		}
 
+		defer func() {
+			mux.Lock()
+			workers--
+			done++
+			if done == len(s3PartPaths) {
+				dsMain.Close()
+			}
+			mux.Unlock()
+		}()
+
 		// Log(F("Reading from s3://%s/%s", s3.Bucket, s3PartPath))
 
 		gzReader, err := s3.ReadStream(s3PartPath)
-		LogError(Error(err, F("Could not s3.ReadStream for s3://%s/%s", s3.Bucket, s3PartPath)))
+		if err != nil {
+			dsMain.SetError(Error(err, F("Could not s3.ReadStream for s3://%s/%s", s3.Bucket, s3PartPath)))
+			return
+		}
 
 		csvPart := CSV{Reader: gzReader}
 		dsPart, err := csvPart.ReadStream()
 		if err != nil {
-			LogError(Error(err, F("Could not csvPart.ReadStream() s3://%s/%s", s3.Bucket, s3PartPath)))
+			dsMain.SetError(Error(err, F("Could not csvPart.ReadStream() s3://%s/%s", s3.Bucket, s3PartPath)))
+			return
 		}
 
 		mux.Lock()
@@ -145,20 +169,14 @@ func (conn *RedshiftConn) BulkExportStream(sql string) (ds Datastream, err error
 
 		// foward to channel, rows will came in disorder
 		for row := range dsPart.Rows {
-			select {
-			case <-dsMain.context.ctx.Done():
-				break
-			case <-dsPart.context.ctx.Done():
-				break
-			default:
-				dsMain.Rows <- row
+			if !dsMain.push(row) {
+				dsPart.Cancel()
+				return
 			}
 		}
-		workers--
-		done++
 
-		if done == len(s3PartPaths) {
-			close(dsMain.Rows)
+		if err := dsPart.Err(); err != nil {
+			dsMain.SetError(Error(err, F("Could not read s3://%s/%s", s3.Bucket, s3PartPath)))
 		}
 	}
 
@@ -171,8 +189,13 @@ func (conn *RedshiftConn) BulkExportStream(sql string) (ds Datastream, err error
 
 	// loop until columns are parsed
 	for {
-		if ds.Columns != nil && ds.Columns[0].Type != "" {
+		mux.Lock()
+		parsed := ds.Columns != nil && ds.Columns[0].Type != ""
+		mux.Unlock()
+		if parsed {
 			break
+		} else if err := ds.Err(); err != nil {
+			return ds, err
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
@@ -192,6 +215,8 @@ func (conn *RedshiftConn) BulkImportStream(tableFName string, ds Datastream) (co
 	s3Path := F("sling/%s.csv", tableFName)
 	AwsID := os.Getenv("AWS_ACCESS_KEY_ID")
 	AwsAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	RegisterSecret(AwsID)
+	RegisterSecret(AwsAccessKey)
 	fileRowLimit := cast.ToInt(conn.GetProp("fileRowLimit"))
 	if fileRowLimit == 0 {
 		fileRowLimit = 500000
@@ -243,6 +268,10 @@ func (conn *RedshiftConn) BulkImportStream(tableFName string, ds Datastream) (co
 		}
 	}
 
+	if err := ds.Err(); err != nil {
+		return count, Error(err, "Upstream stream failed, did not copy into "+tableFName)
+	}
+
 	txn := conn.Db().MustBegin()
 
 	sql := R(
@@ -255,9 +284,8 @@ func (conn *RedshiftConn) BulkImportStream(tableFName string, ds Datastream) (co
 	)
 	_, err = txn.Exec(sql)
 	if err != nil {
-		cleanSQL := strings.ReplaceAll(sql, AwsID, "*****")
-		cleanSQL = strings.ReplaceAll(cleanSQL, AwsAccessKey, "*****")
-		return count, Error(err, "SQL Error:\n"+cleanSQL)
+		txn.Rollback()
+		return count, Error(err, "SQL Error:\n"+sql)
 	}
 
 	err = txn.Commit()
@@ -146,6 +146,38 @@ func TestSQLite(t *testing.T) {
 
 func TestMySQL(t *testing.T) {
 	DBTest(t, DBs["mysql"])
+	MySQLBinaryLoadTest(t, DBs["mysql"])
+}
+
+// MySQLBinaryLoadTest checks that LOAD DATA keeps the bytes of binary columns
+func MySQLBinaryLoadTest(t *testing.T, db *testDB) {
+	if db.URL == "" {
+		return
+	}
+	conn := GetConn(db.URL)
+	if !assert.NoError(t, conn.Connect()) {
+		return
+	}
+
+	table := db.schema + ".binary_load"
+	conn.DropTable(table)
+	conn.Db().MustExec("CREATE TABLE " + table + " (id int, `the payload` blob)")
+
+	data := Dataset{
+		Columns: []Column{{Name: "id", Type: "integer"}, {Name: "the payload", Type: "binary"}},
+		Rows:    [][]interface{}{{int64(1), []byte{0, 159, 146, 150, '"', ','}}, {int64(2), []byte("abc")}},
+	}
+	cnt, err := conn.(*MySQLConn).LoadDataInFile(table, data.Stream())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	loaded, err := conn.Query("select `the payload` from " + table + " order by id")
+	if assert.NoError(t, err) && assert.Len(t, loaded.Rows, 2) {
+		assert.Equal(t, []byte{0, 159, 146, 150, '"', ','}, loaded.Rows[0][0])
+		assert.Equal(t, []byte("abc"), loaded.Rows[1][0])
+	}
+
+	conn.DropTable(table)
 }
 
 func TestOracle(t *testing.T) {
@@ -160,6 +192,79 @@ func TestSqlServer(t *testing.T) {
 	// DBTest(t, DBs["sqlserver"])
 }
 
+func TestGenerateDDL(t *testing.T) {
+	template, err := LoadTemplate("postgres", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn := BaseConn{Type: "postgres", template: template}
+
+	data := Dataset{
+		Columns: []Column{
+			{Name: "code", Type: "string", Length: 50, Nullable: false, nullableKnown: true},
+			{Name: "amount", Type: "decimal", Precision: 18, Scale: 4, Nullable: true, nullableKnown: true},
+			{Name: "note", Type: "string"},
+			{Name: "payload", Type: "binary"},
+			{Name: "attrs", Type: "json"},
+			{Name: "tags", Type: "array"},
+		},
+		Rows: [][]interface{}{{"abc", 1.5, "x", []byte{0, 1}, `{"a": 1}`, `["x"]`}},
+	}
+
+	ddl, err := conn.GenerateDDL("public.test_ddl", data)
+	assert.NoError(t, err)
+	assert.Contains(t, ddl, "code varchar(50) NOT NULL")
+	assert.Contains(t, ddl, "amount decimal(18,4)")
+	assert.NotContains(t, ddl, "amount decimal(18,4) NOT NULL")
+	assert.Contains(t, ddl, "note varchar")
+	assert.NotContains(t, ddl, "note varchar(")
+	assert.Contains(t, ddl, "payload bytea")
+	assert.Contains(t, ddl, "attrs jsonb")
+	assert.Contains(t, ddl, "tags text[]")
+}
+
+func TestBinaryJSONArray(t *testing.T) {
+	payload := []byte{0, 159, 146, 150}
+	assert.Equal(t, payload, processColumnVal(payload, Column{Type: "binary"}))
+	assert.Equal(t, `{"a": 1}`, processColumnVal([]byte(`{"a": 1}`), Column{Type: "json"}))
+	assert.Equal(t, "0.5", processColumnVal([]byte("0.5"), Column{Type: "string"}).(Decimal).String())
+
+	// base64 or hex in CSV files
+	assert.Equal(t, "AJ+Slg==", toString(payload))
+	assert.Equal(t, payload, castVal("AJ+Slg==", "binary"))
+	BinaryEncoding = "hex"
+	assert.Equal(t, "009f9296", toString(payload))
+	assert.Equal(t, payload, castVal(`\x009f9296`, "binary"))
+	BinaryEncoding = "base64"
+
+	// decoded by LOAD DATA in mysql
+	assert.Equal(t, "", mysqlLoadColumns([]Column{{Name: "id", Type: "integer"}}))
+	assert.Equal(t, " (`id`, @col_2) SET `the payload` = UNHEX(@col_2)", mysqlLoadColumns([]Column{{Name: "id", Type: "integer"}, {Name: "the payload", Type: "binary"}}))
+
+	arr, err := pgArrayToJSON(`{1,NULL,3}`, "int4")
+	assert.NoError(t, err)
+	assert.Equal(t, `[1,null,3]`, arr)
+
+	arr, err = pgArrayToJSON(`{{"a b","c\"d"},{NULL,e}}`, "text")
+	assert.NoError(t, err)
+	assert.Equal(t, `[["a b","c\"d"],[null,"e"]]`, arr)
+
+	arr, err = pgArrayToJSON(`[0:1]={t,f}`, "bool")
+	assert.NoError(t, err)
+	assert.Equal(t, `[true,false]`, arr)
+
+	_, err = pgArrayToJSON(`{1,2`, "int4")
+	assert.Error(t, err)
+
+	literal, err := jsonToPgArray(`[["a b","c\"d"],[null,"e"]]`)
+	assert.NoError(t, err)
+	assert.Equal(t, `{{"a b","c\"d"},{NULL,"e"}}`, literal)
+
+	literal, err = jsonToPgArray(`[1.50,true,{"k":1}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, `{1.50,true,"{\"k\":1}"}`, literal)
+}
+
 func DBTest(t *testing.T, db *testDB) {
 	println("Testing " + db.name)
 	if db.URL == "" {
@@ -366,6 +471,16 @@ func DBTest(t *testing.T, db *testDB) {
 	assert.EqualValues(t, int64(2), data.Records()[0]["tot_cnt"])
 	assert.EqualValues(t, int64(0), data.Records()[1]["f_dup_cnt"])
 
+	// RunRoutine number_min_max
+	data, err = conn.RunRoutine("number_min_max", map[string]interface{}{
+		"table": db.schema + ".place",
+		"field": "telcode",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, data.Rows, 1)
+	assert.EqualValues(t, int64(3), cast.ToInt64(data.Records()[0]["tot_cnt"]))
+	assert.EqualValues(t, int64(852), cast.ToInt64(data.Records()[0]["max_val"]))
+
 	// Extract / Load Test
 	if db.name != "sqlite3" {
 		ELTest(t, db, csvTable)
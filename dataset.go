@@ -6,17 +6,24 @@ import (
 	"context"
 	"database/sql"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/spf13/cast"
 )
 
+// SampleSize is the default number of rows sampled to infer the column types
+var SampleSize = 1000
+
 // Context is to manage context
 type Context struct {
 	ctx    context.Context
@@ -31,6 +38,18 @@ type Datastream struct {
 	count   uint64
 	closed  bool
 	context Context
+	state   *streamState
+}
+
+// streamState is shared by the copies of a Datastream
+type streamState struct {
+	rows      uint64 // first, for 64-bit atomic alignment
+	bytes     uint64
+	start     time.Time
+	mux       sync.Mutex
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // Dataset is a query returned dataset
@@ -55,9 +74,107 @@ type ColumnStats struct {
 	boolCnt   int64
 	stringCnt int64
 	dateCnt   int64
+	jsonCnt   int64
+	arrayCnt  int64
 	totalCnt  int64
 }
 
+// add counts a parsed value (see ParseString)
+func (cs *ColumnStats) add(val interface{}) {
+	cs.totalCnt++
+
+	switch v := val.(type) {
+	case time.Time:
+		cs.dateCnt++
+	case nil:
+		cs.nullCnt++
+	case int, int8, int16, int32, int64:
+		cs.intCnt++
+		val0 := cast.ToInt64(val)
+		if val0 > cs.max {
+			cs.max = val0
+		}
+		if val0 < cs.min {
+			cs.min = val0
+		}
+	case float32, float64:
+		cs.decCnt++
+		val0 := cast.ToInt64(val)
+		if val0 > cs.max {
+			cs.max = val0
+		}
+		if val0 < cs.min {
+			cs.min = val0
+		}
+
+		valDec := cast.ToFloat64(val) - cast.ToFloat64(val0)
+		decLen := len(cast.ToString(valDec)) - 2
+		if decLen > cs.maxDecLen {
+			cs.maxDecLen = decLen
+		}
+
+	case Decimal:
+		cs.decCnt++
+		val0 := cast.ToInt64(v.Float64())
+		if val0 > cs.max {
+			cs.max = val0
+		}
+		if val0 < cs.min {
+			cs.min = val0
+		}
+
+		if v.Scale() > cs.maxDecLen {
+			cs.maxDecLen = v.Scale()
+		}
+
+	case bool:
+		cs.boolCnt++
+	case string, []uint8:
+		cs.stringCnt++
+		l := len(cast.ToString(val))
+		if l > cs.maxLen {
+			cs.maxLen = l
+		}
+		if l < cs.minLen {
+			cs.minLen = l
+		}
+
+	case json.RawMessage:
+		if len(v) > 0 && v[0] == '[' {
+			cs.arrayCnt++
+		} else {
+			cs.jsonCnt++
+		}
+
+	default:
+		_ = fmt.Sprint(v)
+	}
+}
+
+// generalType returns the general type of the counted values
+func (cs *ColumnStats) generalType() string {
+	if cs.stringCnt > 0 || cs.nullCnt == cs.totalCnt {
+		if cs.maxLen > 255 {
+			return "text"
+		}
+		return "string"
+	} else if cs.boolCnt+cs.nullCnt == cs.totalCnt {
+		return "bool"
+	} else if cs.intCnt+cs.nullCnt == cs.totalCnt {
+		return "integer"
+	} else if cs.dateCnt+cs.nullCnt == cs.totalCnt {
+		return "datetime"
+	} else if cs.decCnt+cs.intCnt+cs.nullCnt == cs.totalCnt {
+		// integers mixed with decimals, e.g. 1.5 and 2
+		return "decimal"
+	} else if cs.arrayCnt+cs.nullCnt == cs.totalCnt {
+		return "array"
+	} else if cs.jsonCnt+cs.arrayCnt+cs.nullCnt == cs.totalCnt {
+		return "json"
+	}
+	return "string"
+}
+
 // WriteCsv writes to a csv file
 func (data *Dataset) WriteCsv(path string) error {
 	file, err := os.Create(path)
@@ -79,7 +196,7 @@ func (data *Dataset) WriteCsv(path string) error {
 	return nil
 }
 
-// ParseString return an interface
+// ParseString return an interface, parsed with DefaultInferOptions
 // string: "varchar"
 // integer: "integer"
 // decimal: "decimal"
@@ -88,42 +205,102 @@ func (data *Dataset) WriteCsv(path string) error {
 // timestamp: "timestamp"
 // text: "text"
 func ParseString(s string) interface{} {
-	// int
-	i, err := strconv.ParseInt(s, 10, 64)
-	if err == nil {
-		return i
+	return DefaultInferOptions.ParseString(s)
+}
+
+// NewDatastream return a new datastream
+func NewDatastream(columns []Column) (ds Datastream) {
+	return NewDatastreamContext(context.Background(), columns)
+}
+
+// NewDatastreamContext return a new datastream, cancelled with ctx
+func NewDatastreamContext(ctx context.Context, columns []Column) (ds Datastream) {
+	ctx, cancel := context.WithCancel(ctx)
+	return Datastream{
+		Columns: columns,
+		Rows:    make(chan []interface{}),
+		context: Context{ctx, cancel},
+		state:   &streamState{done: make(chan struct{}), start: time.Now()},
 	}
+}
 
-	// float
-	f, err := strconv.ParseFloat(s, 64)
-	if err == nil {
-		return f
+// SetError records the first error of the stream and cancels it.
+// The producer should still call Close afterwards.
+func (ds *Datastream) SetError(err error) {
+	if err == nil || ds.state == nil {
+		return
 	}
 
-	// date layouts to try out
-	layouts := []string{
-		"2006-01-02",
-		"2006-01-02 15:04:05",
-		"2006-01-02 15:04:05.000",
-		"2006-01-02T15:04:05.000Z",
-		"01-JAN-02",
-		"01-JAN-02 15:04:05",
+	ds.state.mux.Lock()
+	if ds.state.err == nil {
+		ds.state.err = err
 	}
-	for _, layout := range layouts {
-		t, err := time.Parse(layout, s)
-		if err == nil {
-			return t
-		}
+	ds.state.mux.Unlock()
+
+	ds.Cancel()
+}
+
+// Err returns the error of the stream, if any
+func (ds *Datastream) Err() error {
+	if ds.state == nil {
+		return nil
+	}
+	ds.state.mux.Lock()
+	defer ds.state.mux.Unlock()
+	return ds.state.err
+}
+
+// Close closes the rows channel, signaling the end of the stream
+func (ds *Datastream) Close() {
+	if ds.state == nil {
+		close(ds.Rows)
+		return
 	}
+	ds.state.closeOnce.Do(func() {
+		close(ds.Rows)
+		close(ds.state.done)
+	})
+}
 
-	// boolean
-	// causes issues in SQLite and Oracle
-	// b, err := strconv.ParseBool(s)
-	// if err == nil {
-	// 	return b
-	// }
+// Wait waits for the producer to close the stream and returns its error
+func (ds *Datastream) Wait() error {
+	if ds.state != nil {
+		<-ds.state.done
+	}
+	return ds.Err()
+}
 
-	return s
+// Cancel cancels the context of the stream, stopping the producer
+func (ds *Datastream) Cancel() {
+	if ds.context.cancel != nil {
+		ds.context.cancel()
+	}
+}
+
+// Context returns the context of the stream
+func (ds *Datastream) Context() context.Context {
+	if ds.context.ctx == nil {
+		return context.Background()
+	}
+	return ds.context.ctx
+}
+
+// push sends a row downstream, returns false if the stream is cancelled
+func (ds *Datastream) push(row []interface{}) bool {
+	if ds.Context().Err() != nil {
+		return false
+	}
+
+	select {
+	case <-ds.Context().Done():
+		return false
+	case ds.Rows <- row:
+		if ds.state != nil {
+			atomic.AddUint64(&ds.state.rows, 1)
+			atomic.AddUint64(&ds.state.bytes, rowSize(row))
+		}
+		return true
+	}
 }
 
 // GetFields return the fields of the Data
@@ -166,9 +343,27 @@ func (ds *Datastream) Collect() Dataset {
 	return data
 }
 
-// InferTypes infers types if needed and add to Buffer
-// Experimental....
-func (ds *Datastream) InferTypes() {
+// Stream returns a datastream of the dataset rows
+func (data *Dataset) Stream() Datastream {
+	ds := NewDatastream(data.Columns)
+
+	go func() {
+		defer ds.Close()
+		for _, row := range data.Rows {
+			if !ds.push(row) {
+				return
+			}
+		}
+	}()
+
+	return ds
+}
+
+// InferTypes returns a new datastream with the column types inferred
+// from the first sampleSize rows (SampleSize if 0). The sample rows are
+// cast and kept in Buffer, then replayed before the remaining rows.
+// ds is returned as is if all its columns already have a type.
+func (ds *Datastream) InferTypes(sampleSize int) (Datastream, error) {
 	infer := false
 	for _, col := range ds.Columns {
 		if col.Type == "" {
@@ -177,31 +372,71 @@ func (ds *Datastream) InferTypes() {
 	}
 
 	if !infer {
-		return
+		return *ds, nil
 	}
 
-	c := 0
-	for row := range ds.Rows {
-		c++
-		ds.Buffer = append(ds.Buffer, row)
-		if c == 1000 {
-			data := Dataset{
-				Columns: ds.Columns,
-				Rows:    ds.Buffer,
+	if sampleSize <= 0 {
+		sampleSize = SampleSize
+	}
+
+	buffer := [][]interface{}{}
+	if sampleSize > 0 {
+		for row := range ds.Rows {
+			buffer = append(buffer, row)
+			if len(buffer) == sampleSize {
+				break
 			}
-			data.InferColumnTypes()
-			ds.Columns = data.Columns
-			buffer := make([][]interface{}, len(ds.Buffer))
-			for i, row1 := range ds.Buffer {
-				row2 := make([]interface{}, len(row1))
-				for j, val := range row1 {
-					row2[j] = castVal(val, ds.Columns[j].Type)
-				}
-				buffer[i] = row2
+		}
+	}
+
+	if err := ds.Err(); err != nil {
+		return *ds, Error(err, "Could not read sample to infer types")
+	}
+
+	sample := Dataset{Columns: ds.Columns, Rows: buffer}
+	sample.inferColumnTypes(len(buffer))
+	columns := sample.Columns
+	if len(buffer) == 0 {
+		// nothing to infer from
+		columns = copyColumns(ds.Columns)
+		for i := range columns {
+			columns[i].Type = "string"
+		}
+	}
+
+	// a value that cannot be cast fails the stream, instead of being lost
+	castRow := func(row []interface{}) ([]interface{}, error) {
+		newRow := make([]interface{}, len(row))
+		for i, val := range row {
+			nVal, err := castValE(val, columns[i].Type)
+			if err != nil {
+				return nil, Error(err, F("Could not cast column %s to the inferred type", columns[i].Name))
 			}
-			ds.Buffer = buffer // buffer is now typed
+			newRow[i] = nVal
+		}
+		return newRow, nil
+	}
+
+	// buffer is now typed
+	for i, row := range buffer {
+		newRow, err := castRow(row)
+		if err != nil {
+			ds.Cancel()
+			return *ds, err
 		}
+		buffer[i] = newRow
 	}
+
+	dsOut := ds.pipeBuffer(
+		columns, buffer,
+		func(row []interface{}) ([]interface{}, bool, error) {
+			newRow, err := castRow(row)
+			return newRow, false, err
+		},
+	)
+	dsOut.Buffer = buffer
+
+	return dsOut, nil
 }
 
 // GetFields return the fields of the Data
@@ -247,6 +482,22 @@ func (data *Dataset) setColumns(colTypes []*sql.ColumnType, NativeTypeMap map[st
 			Position: int64(i + 1),
 			Type:     Type,
 			colType:  colType,
+			floating: floatingTypes[strings.ToLower(colType.DatabaseTypeName())],
+		}
+
+		// unbounded types (text, bytea) report a huge length
+		if length, ok := colType.Length(); ok && length > 0 && length < math.MaxInt32 {
+			data.Columns[i].Length = int(length)
+		}
+		if precision, scale, ok := colType.DecimalSize(); ok && precision > 0 && precision < 1000 {
+			data.Columns[i].Precision = int(precision)
+			if scale > 0 {
+				data.Columns[i].Scale = int(scale)
+			}
+		}
+		if nullable, ok := colType.Nullable(); ok {
+			data.Columns[i].Nullable = nullable
+			data.Columns[i].nullableKnown = true
 		}
 	}
 
@@ -265,10 +516,13 @@ func (data *Dataset) Records() []map[string]interface{} {
 	return records
 }
 
-// InferColumnTypes determines the columns types
+// InferColumnTypes determines the columns types, from the first SampleSize rows
 func (data *Dataset) InferColumnTypes() {
-	const N = 1000 // Sample Size
+	data.inferColumnTypes(SampleSize)
+}
 
+// inferColumnTypes determines the columns types from the first n rows
+func (data *Dataset) inferColumnTypes(n int) {
 	var columns []Column
 
 	if len(data.Rows) == 0 {
@@ -285,79 +539,24 @@ func (data *Dataset) InferColumnTypes() {
 	}
 
 	for i, row := range data.Rows {
-		if i > N {
+		if i >= n {
 			break
 		}
 
 		for j, val := range row {
-			val = ParseString(cast.ToString(val))
-			columns[j].stats.totalCnt++
-
-			switch v := val.(type) {
-			case time.Time:
-				columns[j].stats.dateCnt++
-			case nil:
-				columns[j].stats.nullCnt++
-			case int, int8, int16, int32, int64:
-				columns[j].stats.intCnt++
-				val0 := cast.ToInt64(val)
-				if val0 > columns[j].stats.max {
-					columns[j].stats.max = val0
-				}
-				if val0 < columns[j].stats.min {
-					columns[j].stats.min = val0
-				}
-			case float32, float64:
-				columns[j].stats.decCnt++
-				val0 := cast.ToInt64(val)
-				if val0 > columns[j].stats.max {
-					columns[j].stats.max = val0
-				}
-				if val0 < columns[j].stats.min {
-					columns[j].stats.min = val0
-				}
-
-				valDec := cast.ToFloat64(val) - cast.ToFloat64(val0)
-				decLen := len(cast.ToString(valDec)) - 2
-				if decLen > columns[j].stats.maxDecLen {
-					columns[j].stats.maxDecLen = decLen
-				}
-
-			case bool:
-				columns[j].stats.boolCnt++
-			case string, []uint8:
-				columns[j].stats.stringCnt++
-				l := len(cast.ToString(val))
-				if l > columns[j].stats.maxLen {
-					columns[j].stats.maxLen = l
-				}
-				if l < columns[j].stats.minLen {
-					columns[j].stats.minLen = l
-				}
-
+			switch val.(type) {
+			case nil, bool, json.RawMessage:
+				// typed, as read from JSON
+				columns[j].stats.add(val)
 			default:
-				_ = fmt.Sprint(v)
+				columns[j].stats.add(ParseString(cast.ToString(val)))
 			}
 		}
 	}
 
 	for j := range data.GetFields() {
 		// PrintV(columns[j].stats)
-		if columns[j].stats.stringCnt > 0 || columns[j].stats.nullCnt == columns[j].stats.totalCnt {
-			if columns[j].stats.maxLen > 255 {
-				columns[j].Type = "text"
-			} else {
-				columns[j].Type = "string"
-			}
-		} else if columns[j].stats.boolCnt+columns[j].stats.nullCnt == columns[j].stats.totalCnt {
-			columns[j].Type = "bool"
-		} else if columns[j].stats.intCnt+columns[j].stats.nullCnt == columns[j].stats.totalCnt {
-			columns[j].Type = "integer"
-		} else if columns[j].stats.dateCnt+columns[j].stats.nullCnt == columns[j].stats.totalCnt {
-			columns[j].Type = "datetime"
-		} else if columns[j].stats.decCnt+columns[j].stats.nullCnt == columns[j].stats.totalCnt {
-			columns[j].Type = "decimal"
-		}
+		columns[j].Type = columns[j].stats.generalType()
 	}
 
 	data.Columns = columns
@@ -384,7 +583,16 @@ func (ds *Datastream) NewCsvReader(limit int) *io.PipeReader {
 			// convert to csv string
 			row := make([]string, len(row0))
 			for i, val := range row0 {
-				row[i] = cast.ToString(val)
+				switch v := val.(type) {
+				case []byte:
+					// hex, as loaded by sqlldr (RAW, BLOB) and redshift (VARBYTE)
+					row[i] = hex.EncodeToString(v)
+				case time.Time:
+					// in the session timezone of the loader (see TargetTimezone)
+					row[i] = normalizeTime(v, ds.column(i).Type).(time.Time).Format(DatetimeLayout)
+				default:
+					row[i] = cast.ToString(val)
+				}
 			}
 			err := w.Write(row)
 			if err != nil {
@@ -402,6 +610,12 @@ func (ds *Datastream) NewCsvReader(limit int) *io.PipeReader {
 			ds.closed = true
 		}
 
+		if err := ds.Err(); err != nil {
+			// the reader fails instead of ending as a short file
+			pipeW.CloseWithError(err)
+			return
+		}
+
 		pipeW.Close()
 	}()
 
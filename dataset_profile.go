@@ -0,0 +1,373 @@
+package gxutil
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// ProfileTopK is the number of most frequent values kept by Profile
+var ProfileTopK = 10
+
+// ColumnProfile holds the profiling statistics of a column
+type ColumnProfile struct {
+	Name           string       `json:"name"`
+	Type           string       `json:"type"`            // inferred general type
+	TypeConfidence float64      `json:"type_confidence"` // share of the non-null values of Type
+	TotalCnt       int64        `json:"total_cnt"`
+	NullCnt        int64        `json:"null_cnt"`
+	NullPct        float64      `json:"null_pct"`
+	DistinctCnt    int64        `json:"distinct_cnt"` // estimate
+	Min            interface{}  `json:"min"`          // numbers and dates only
+	Max            interface{}  `json:"max"`
+	MinLen         int          `json:"min_len"`
+	AvgLen         float64      `json:"avg_len"`
+	P50Len         int          `json:"p50_len"`
+	P90Len         int          `json:"p90_len"`
+	MaxLen         int          `json:"max_len"`
+	TopValues      []ValueCount `json:"top_values"` // approximate for many distinct values
+}
+
+// ValueCount is a value and its count
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// DataProfile is the profile of the columns of a Dataset or Datastream
+type DataProfile struct {
+	Rows    int64           `json:"rows"`
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// JSON returns the profile as JSON
+func (dp DataProfile) JSON() ([]byte, error) {
+	return json.MarshalIndent(dp, "", "  ")
+}
+
+// Dataset returns the profile as a dataset, with a row per column
+func (dp DataProfile) Dataset() Dataset {
+	fields := []string{
+		"column_name", "type", "type_confidence", "total_cnt", "null_cnt",
+		"null_pct", "distinct_cnt", "min", "max", "min_len", "avg_len",
+		"p50_len", "p90_len", "max_len", "top_values",
+	}
+
+	types := []string{
+		"string", "string", "decimal", "integer", "integer",
+		"decimal", "integer", "string", "string", "integer", "decimal",
+		"integer", "integer", "integer", "text",
+	}
+
+	data := Dataset{}
+	data.setFields(fields)
+	for i := range data.Columns {
+		data.Columns[i].Type = types[i]
+	}
+
+	for _, col := range dp.Columns {
+		var min, max interface{}
+		if col.Min != nil {
+			min, max = toString(col.Min), toString(col.Max)
+		}
+
+		topValues, _ := json.Marshal(col.TopValues)
+		data.Rows = append(data.Rows, []interface{}{
+			col.Name, col.Type, col.TypeConfidence, col.TotalCnt, col.NullCnt,
+			col.NullPct, col.DistinctCnt, min, max, col.MinLen, col.AvgLen,
+			col.P50Len, col.P90Len, col.MaxLen, string(topValues),
+		})
+	}
+
+	return data
+}
+
+// Profile returns the profile of the columns of the dataset
+func (data *Dataset) Profile() DataProfile {
+	p := newDataProfiler(data.Columns)
+	for _, row := range data.Rows {
+		p.add(row)
+	}
+	return p.profile()
+}
+
+// Profile consumes the stream and returns the profile of its columns
+func (ds *Datastream) Profile() (DataProfile, error) {
+	p := newDataProfiler(ds.Columns)
+	for row := range ds.Rows {
+		p.add(row)
+	}
+
+	if err := ds.Err(); err != nil {
+		return p.profile(), Error(err, "Could not profile stream")
+	}
+	return p.profile(), nil
+}
+
+// dataProfiler accumulates the profiles of columns, row by row
+type dataProfiler struct {
+	rows    int64
+	columns []*columnProfiler
+}
+
+func newDataProfiler(columns []Column) *dataProfiler {
+	p := &dataProfiler{}
+	for _, col := range columns {
+		p.columns = append(p.columns, &columnProfiler{
+			name:      col.Name,
+			distinct:  &hyperLogLog{},
+			top:       newTopValues(ProfileTopK * 10),
+			lenCounts: map[int]int64{},
+		})
+	}
+	return p
+}
+
+func (p *dataProfiler) add(row []interface{}) {
+	p.rows++
+	for i, val := range row {
+		if i < len(p.columns) {
+			p.columns[i].add(val)
+		}
+	}
+}
+
+func (p *dataProfiler) profile() DataProfile {
+	dp := DataProfile{Rows: p.rows}
+	for _, col := range p.columns {
+		dp.Columns = append(dp.Columns, col.profile())
+	}
+	return dp
+}
+
+// columnProfiler accumulates the profile of a column
+type columnProfiler struct {
+	name      string
+	stats     ColumnStats
+	distinct  *hyperLogLog
+	top       *topValues
+	lenCounts map[int]int64
+	lenSum    int64
+	numCnt    int64
+	minNum    float64
+	maxNum    float64
+	minDate   time.Time
+	maxDate   time.Time
+}
+
+func (cp *columnProfiler) add(val interface{}) {
+	// typed values are kept, strings are parsed
+	switch v := val.(type) {
+	case string:
+		val = ParseString(v)
+	case []byte:
+		val = ParseString(string(v))
+	}
+	cp.stats.add(val)
+
+	switch v := val.(type) {
+	case nil:
+		return
+	case time.Time:
+		if cp.stats.dateCnt == 1 || v.Before(cp.minDate) {
+			cp.minDate = v
+		}
+		if cp.stats.dateCnt == 1 || v.After(cp.maxDate) {
+			cp.maxDate = v
+		}
+	case int, int8, int16, int32, int64, float32, float64, Decimal:
+		cp.numCnt++
+		num := cast.ToFloat64(v)
+		if d, ok := v.(Decimal); ok {
+			num = d.Float64()
+		}
+		if cp.numCnt == 1 || num < cp.minNum {
+			cp.minNum = num
+		}
+		if cp.numCnt == 1 || num > cp.maxNum {
+			cp.maxNum = num
+		}
+	}
+
+	valStr := toString(val)
+	cp.distinct.add(valStr)
+	cp.top.add(valStr)
+	cp.lenCounts[len(valStr)]++
+	cp.lenSum += int64(len(valStr))
+}
+
+func (cp *columnProfiler) profile() ColumnProfile {
+	stats := cp.stats
+	colProfile := ColumnProfile{
+		Name:        cp.name,
+		Type:        stats.generalType(),
+		TotalCnt:    stats.totalCnt,
+		NullCnt:     stats.nullCnt,
+		DistinctCnt: cp.distinct.count(),
+		TopValues:   cp.top.top(ProfileTopK),
+	}
+
+	if stats.totalCnt > 0 {
+		colProfile.NullPct = round(100*float64(stats.nullCnt)/float64(stats.totalCnt), 2)
+	}
+
+	nonNullCnt := stats.totalCnt - stats.nullCnt
+	if nonNullCnt == 0 {
+		return colProfile
+	}
+
+	typeCnt := map[string]int64{
+		"string":      stats.stringCnt,
+		"text":        stats.stringCnt,
+		"bool":        stats.boolCnt,
+		"integer":     stats.intCnt,
+		"decimal":     stats.intCnt + stats.decCnt,
+		"date":        stats.dateCnt,
+		"datetime":    stats.dateCnt,
+		"timestamptz": stats.dateCnt,
+		"array":       stats.arrayCnt,
+		"json":        stats.jsonCnt + stats.arrayCnt,
+	}
+	colProfile.TypeConfidence = round(float64(typeCnt[colProfile.Type])/float64(nonNullCnt), 4)
+
+	switch colProfile.Type {
+	case "integer":
+		colProfile.Min, colProfile.Max = int64(cp.minNum), int64(cp.maxNum)
+	case "decimal":
+		colProfile.Min, colProfile.Max = cp.minNum, cp.maxNum
+	case "date", "datetime", "timestamptz":
+		colProfile.Min, colProfile.Max = cp.minDate, cp.maxDate
+	}
+
+	// length distribution
+	lengths := []int{}
+	for l := range cp.lenCounts {
+		lengths = append(lengths, l)
+	}
+	sort.Ints(lengths)
+
+	colProfile.MinLen = lengths[0]
+	colProfile.MaxLen = lengths[len(lengths)-1]
+	colProfile.AvgLen = round(float64(cp.lenSum)/float64(nonNullCnt), 2)
+
+	cumCnt := int64(0)
+	colProfile.P50Len, colProfile.P90Len = -1, -1
+	for _, l := range lengths {
+		cumCnt += cp.lenCounts[l]
+		if colProfile.P50Len == -1 && cumCnt*2 >= nonNullCnt {
+			colProfile.P50Len = l
+		}
+		if colProfile.P90Len == -1 && cumCnt*10 >= nonNullCnt*9 {
+			colProfile.P90Len = l
+		}
+	}
+
+	return colProfile
+}
+
+// round rounds val to n decimals
+func round(val float64, n int) float64 {
+	pow := math.Pow(10, float64(n))
+	return math.Round(val*pow) / pow
+}
+
+const hllPrecision = 12
+
+// hyperLogLog estimates the number of distinct values
+// (https://en.wikipedia.org/wiki/HyperLogLog), ~1.6% standard error
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(val string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(val))
+	x := mix64(hash.Sum64())
+
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) count() int64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0.0
+	for _, r := range h.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting, for small cardinalities
+		estimate = m * math.Log(m/zeros)
+	}
+	return int64(math.Round(estimate))
+}
+
+// mix64 is the murmur3 finalizer, spreading the bits of the fnv hash
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// topValues counts the most frequent values with the Space-Saving
+// algorithm: when full, a new value replaces the least counted one
+type topValues struct {
+	capacity int
+	counts   map[string]int64
+}
+
+func newTopValues(capacity int) *topValues {
+	return &topValues{capacity: capacity, counts: map[string]int64{}}
+}
+
+func (t *topValues) add(val string) {
+	if _, ok := t.counts[val]; ok || len(t.counts) < t.capacity {
+		t.counts[val]++
+		return
+	}
+
+	minVal, minCnt := "", int64(-1)
+	for v, c := range t.counts {
+		if minCnt == -1 || c < minCnt {
+			minVal, minCnt = v, c
+		}
+	}
+	delete(t.counts, minVal)
+	t.counts[val] = minCnt + 1
+}
+
+// top returns the k most frequent values
+func (t *topValues) top(k int) []ValueCount {
+	values := []ValueCount{}
+	for v, c := range t.counts {
+		values = append(values, ValueCount{v, c})
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count == values[j].Count {
+			return values[i].Value < values[j].Value
+		}
+		return values[i].Count > values[j].Count
+	})
+
+	if len(values) > k {
+		values = values[:k]
+	}
+	return values
+}
@@ -0,0 +1,83 @@
+package gxutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataProfile(t *testing.T) {
+	date1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	date2 := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	data := Dataset{
+		Columns: []Column{{Name: "id"}, {Name: "amount"}, {Name: "name"}, {Name: "created"}},
+		Rows: [][]interface{}{
+			{"1", "10.5", "alice", date1},
+			{"2", "-3", "bob", nil},
+			{"3", nil, "bob", date2},
+			{"4", "7", "n/a", date1},
+		},
+	}
+
+	dp := data.Profile()
+	assert.EqualValues(t, 4, dp.Rows)
+	if !assert.Len(t, dp.Columns, 4) {
+		return
+	}
+
+	id := dp.Columns[0]
+	assert.Equal(t, "integer", id.Type)
+	assert.Equal(t, 1.0, id.TypeConfidence)
+	assert.EqualValues(t, 4, id.DistinctCnt)
+	assert.Equal(t, int64(1), id.Min)
+	assert.Equal(t, int64(4), id.Max)
+
+	amount := dp.Columns[1]
+	assert.Equal(t, "decimal", amount.Type)
+	assert.Equal(t, 25.0, amount.NullPct)
+	assert.Equal(t, -3.0, amount.Min)
+	assert.Equal(t, 10.5, amount.Max)
+
+	name := dp.Columns[2]
+	assert.Equal(t, "string", name.Type)
+	assert.EqualValues(t, 3, name.DistinctCnt)
+	assert.Equal(t, ValueCount{"bob", 2}, name.TopValues[0])
+	assert.Equal(t, 3, name.MinLen)
+	assert.Equal(t, 3, name.P50Len)
+	assert.Equal(t, 5, name.MaxLen)
+
+	created := dp.Columns[3]
+	assert.Equal(t, "datetime", created.Type)
+	assert.Equal(t, date1, created.Min)
+	assert.Equal(t, date2, created.Max)
+
+	profileData := dp.Dataset()
+	assert.Len(t, profileData.Rows, 4)
+	assert.Equal(t, "name", profileData.Records()[2]["column_name"])
+
+	profileJSON, err := dp.JSON()
+	assert.NoError(t, err)
+	assert.True(t, json.Valid(profileJSON))
+
+	ds := data.Stream()
+	dsProfile, err := ds.Profile()
+	assert.NoError(t, err)
+	assert.Equal(t, dp.Columns[2].TopValues, dsProfile.Columns[2].TopValues)
+
+	// json and array values, as read from JSON Lines
+	data = Dataset{
+		Columns: []Column{{Name: "attrs"}, {Name: "tags"}},
+		Rows: [][]interface{}{
+			{json.RawMessage(`{"k":"v"}`), json.RawMessage(`["x"]`)},
+			{json.RawMessage(`["y"]`), nil},
+			{nil, json.RawMessage(`[]`)},
+		},
+	}
+	dp = data.Profile()
+	assert.Equal(t, "json", dp.Columns[0].Type)
+	assert.Equal(t, 1.0, dp.Columns[0].TypeConfidence)
+	assert.Equal(t, "array", dp.Columns[1].Type)
+	assert.Equal(t, 1.0, dp.Columns[1].TypeConfidence)
+}
@@ -1,6 +1,7 @@
 package gxutil
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -118,6 +119,59 @@ func TestCSV(t *testing.T) {
 
 }
 
+func TestDatastreamError(t *testing.T) {
+	ds := NewDatastream([]Column{{Name: "id", Type: "integer"}})
+
+	go func() {
+		defer ds.Close()
+		ds.push([]interface{}{1})
+		ds.SetError(errors.New("source failed"))
+		ds.SetError(errors.New("second error"))
+		ds.push([]interface{}{2})
+	}()
+
+	csv1 := CSV{Path: "test/test_error.csv"}
+	defer os.Remove(csv1.Path)
+
+	_, err := csv1.WriteStream(ds)
+	assert.Error(t, err)
+	assert.EqualError(t, ds.Wait(), "source failed")
+	assert.Error(t, ds.Context().Err())
+}
+
+func TestDatastreamInferTypes(t *testing.T) {
+	data := Dataset{
+		Columns: []Column{{Position: 1, Name: "id"}, {Position: 2, Name: "amount"}, {Position: 3, Name: "name"}},
+		Rows: [][]interface{}{
+			{"1", "1.5", "a"},
+			{"2", "2", "b"},
+			{"3", "x", "c"},
+		},
+	}
+
+	ds := data.Stream()
+	ds, err := ds.InferTypes(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "integer", ds.Columns[0].Type)
+	assert.Equal(t, "decimal", ds.Columns[1].Type)
+	assert.Equal(t, "string", ds.Columns[2].Type)
+	assert.Len(t, ds.Buffer, 2)
+
+	// a later value not of the inferred type fails the stream
+	result := ds.Collect()
+	assert.Error(t, ds.Err())
+	assert.Len(t, result.Rows, 2)
+	assert.Equal(t, []interface{}{int64(1), Decimal("1.5"), "a"}, result.Rows[0])
+
+	data.Rows[2][1] = "3"
+	ds = data.Stream()
+	ds, err = ds.InferTypes(2)
+	assert.NoError(t, err)
+	result = ds.Collect()
+	assert.NoError(t, ds.Err())
+	assert.Equal(t, []interface{}{int64(3), Decimal("3"), "c"}, result.Rows[2])
+}
+
 func bParseString(val string, b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		ParseString(val)
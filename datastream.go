@@ -0,0 +1,438 @@
+package gxutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// pipeFunc transforms a row of a piped stream. A nil newRow drops the row,
+// stop ends the new stream after the row.
+type pipeFunc func(row []interface{}) (newRow []interface{}, stop bool, err error)
+
+// pipe returns a new datastream with columns, streaming the rows of ds
+// through fn. An error of fn or ds fails the new stream, and cancelling
+// the new stream cancels ds.
+func (ds *Datastream) pipe(columns []Column, fn pipeFunc) Datastream {
+	return ds.pipeBuffer(columns, nil, fn)
+}
+
+// pipeBuffer is pipe, with the rows of buffer streamed first (as is)
+func (ds *Datastream) pipeBuffer(columns []Column, buffer [][]interface{}, fn pipeFunc) Datastream {
+	// copy, the caller commonly reassigns its variable to the new stream
+	src := *ds
+
+	// not derived from the context of ds, so that a stopped ds does not
+	// cancel the rows not yet consumed downstream. Errors are passed on.
+	dsOut := NewDatastream(columns)
+
+	go func() {
+		select {
+		case <-dsOut.Context().Done():
+			src.Cancel()
+		case <-dsOut.state.done:
+		}
+	}()
+
+	go func() {
+		defer dsOut.Close()
+
+		for _, row := range buffer {
+			if !dsOut.push(row) {
+				src.Cancel()
+				return
+			}
+		}
+
+		for row := range src.Rows {
+			newRow, stop, err := fn(row)
+			if err != nil {
+				dsOut.SetError(err)
+				src.Cancel()
+				return
+			}
+
+			if newRow != nil && !dsOut.push(newRow) {
+				src.Cancel()
+				return
+			}
+
+			if stop {
+				src.Cancel()
+				return
+			}
+		}
+
+		dsOut.SetError(src.Err())
+	}()
+
+	return dsOut
+}
+
+// copyColumns returns a copy of the columns
+func copyColumns(columns []Column) []Column {
+	newColumns := make([]Column, len(columns))
+	copy(newColumns, columns)
+	return newColumns
+}
+
+// columnIndex returns the index of the named column (case insensitive)
+func (ds *Datastream) columnIndex(name string) (int, error) {
+	for i, col := range ds.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return i, nil
+		}
+	}
+	return -1, errors.New(F("Column '%s' not found in stream (%s)", name, strings.Join(ds.GetFields(), ", ")))
+}
+
+// column returns the column i, empty if a row is wider than the columns
+func (ds *Datastream) column(i int) Column {
+	if i < len(ds.Columns) {
+		return ds.Columns[i]
+	}
+	return Column{}
+}
+
+// Map returns a new datastream with the rows transformed by fn.
+// The returned rows must keep the columns of ds, a nil row is dropped.
+func (ds *Datastream) Map(fn func(row []interface{}) ([]interface{}, error)) Datastream {
+	return ds.pipe(
+		copyColumns(ds.Columns),
+		func(row []interface{}) ([]interface{}, bool, error) {
+			newRow, err := fn(row)
+			return newRow, false, err
+		},
+	)
+}
+
+// Filter returns a new datastream with the rows for which fn is true
+func (ds *Datastream) Filter(fn func(row []interface{}) bool) Datastream {
+	return ds.pipe(
+		copyColumns(ds.Columns),
+		func(row []interface{}) ([]interface{}, bool, error) {
+			if !fn(row) {
+				return nil, false, nil
+			}
+			return row, false, nil
+		},
+	)
+}
+
+// SelectColumns returns a new datastream with the named columns, in order
+func (ds *Datastream) SelectColumns(names ...string) (Datastream, error) {
+	indexes := make([]int, len(names))
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		j, err := ds.columnIndex(name)
+		if err != nil {
+			return Datastream{}, err
+		}
+		indexes[i] = j
+		columns[i] = ds.Columns[j]
+		columns[i].Position = int64(i + 1)
+	}
+
+	dsOut := ds.pipe(
+		columns,
+		func(row []interface{}) ([]interface{}, bool, error) {
+			newRow := make([]interface{}, len(indexes))
+			for i, j := range indexes {
+				newRow[i] = row[j]
+			}
+			return newRow, false, nil
+		},
+	)
+	return dsOut, nil
+}
+
+// RenameColumns returns a new datastream with columns renamed
+// from the keys of names to their values
+func (ds *Datastream) RenameColumns(names map[string]string) (Datastream, error) {
+	columns := copyColumns(ds.Columns)
+	for name, newName := range names {
+		i, err := ds.columnIndex(name)
+		if err != nil {
+			return Datastream{}, err
+		}
+		columns[i].Name = newName
+	}
+
+	dsOut := ds.pipe(
+		columns,
+		func(row []interface{}) ([]interface{}, bool, error) {
+			return row, false, nil
+		},
+	)
+	return dsOut, nil
+}
+
+// CastColumns returns a new datastream with the values of the columns
+// cast to the general types of types, by column name
+func (ds *Datastream) CastColumns(types map[string]string) (Datastream, error) {
+	srcColumns := ds.Columns
+	columns := copyColumns(ds.Columns)
+	for name, colType := range types {
+		i, err := ds.columnIndex(name)
+		if err != nil {
+			return Datastream{}, err
+		}
+		columns[i].Type = colType
+	}
+
+	dsOut := ds.pipe(
+		columns,
+		func(row []interface{}) ([]interface{}, bool, error) {
+			newRow := make([]interface{}, len(row))
+			for i, val := range row {
+				if columns[i].Type != srcColumns[i].Type {
+					val = castVal(val, columns[i].Type)
+				}
+				newRow[i] = val
+			}
+			return newRow, false, nil
+		},
+	)
+	return dsOut, nil
+}
+
+// AddComputedColumn returns a new datastream with the column col
+// appended, its value computed by fn for each row
+func (ds *Datastream) AddComputedColumn(col Column, fn func(row []interface{}) (interface{}, error)) Datastream {
+	columns := append(copyColumns(ds.Columns), col)
+	columns[len(columns)-1].Position = int64(len(columns))
+
+	return ds.pipe(
+		columns,
+		func(row []interface{}) ([]interface{}, bool, error) {
+			val, err := fn(row)
+			if err != nil {
+				return nil, false, Error(err, "Could not compute column "+col.Name)
+			}
+			newRow := make([]interface{}, len(row), len(row)+1)
+			copy(newRow, row)
+			return append(newRow, val), false, nil
+		},
+	)
+}
+
+// Limit returns a new datastream with the first n rows of ds.
+// ds is cancelled once n rows are reached.
+func (ds *Datastream) Limit(n uint64) Datastream {
+	count := uint64(0)
+	return ds.pipe(
+		copyColumns(ds.Columns),
+		func(row []interface{}) ([]interface{}, bool, error) {
+			count++
+			if count > n {
+				return nil, true, nil
+			}
+			return row, count == n, nil
+		},
+	)
+}
+
+// Split returns n datastreams, each receiving all the rows of ds.
+// A row is sent to every stream before the next one is read, so the
+// streams must be consumed concurrently and the slowest sets the pace.
+// If a stream is cancelled or fails, all the streams fail and ds is cancelled.
+func (ds *Datastream) Split(n int) []Datastream {
+	src := *ds
+	ctx, cancel := context.WithCancel(context.Background())
+
+	streams := make([]Datastream, n)
+	for i := range streams {
+		streams[i] = NewDatastreamContext(ctx, copyColumns(src.Columns))
+
+		// a stream cancelled by its consumer cancels its siblings
+		go func(dsOut Datastream) {
+			select {
+			case <-dsOut.Context().Done():
+				cancel()
+			case <-dsOut.state.done:
+			}
+		}(streams[i])
+	}
+
+	go func() {
+		defer func() {
+			for i := range streams {
+				streams[i].Close()
+			}
+		}()
+
+		for row := range src.Rows {
+			for i := range streams {
+				newRow := row
+				if i > 0 {
+					// each consumer gets its own row, it may be modified
+					newRow = make([]interface{}, len(row))
+					copy(newRow, row)
+				}
+
+				if !streams[i].push(newRow) {
+					err := errors.New("split stream cancelled")
+					for j := range streams {
+						if streams[j].Err() != nil {
+							err = streams[j].Err()
+							break
+						}
+					}
+					for j := range streams {
+						streams[j].SetError(err)
+					}
+					cancel()
+					src.Cancel()
+					return
+				}
+			}
+		}
+
+		for i := range streams {
+			streams[i].SetError(src.Err())
+		}
+	}()
+
+	return streams
+}
+
+// Tee streams all the rows of ds to each of the sinks, concurrently
+// (see Split). If a sink returns an error, the other sinks are cancelled
+// and the first error is returned. A sink returning early without error
+// has its remaining rows discarded.
+func (ds *Datastream) Tee(sinks ...func(ds Datastream) error) error {
+	var mux sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+
+	streams := ds.Split(len(sinks))
+	for i, sink := range sinks {
+		wg.Add(1)
+		go func(dsSink Datastream, sink func(ds Datastream) error) {
+			defer wg.Done()
+
+			err := sink(dsSink)
+			if err != nil {
+				mux.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mux.Unlock()
+				dsSink.SetError(err)
+			}
+
+			// do not block the other sinks
+			for range dsSink.Rows {
+			}
+		}(streams[i], sink)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ds.Err()
+}
+
+// Progress is a snapshot of the rows streamed by a Datastream
+type Progress struct {
+	Rows    uint64        `json:"rows"`
+	Bytes   uint64        `json:"bytes"` // approximate, see rowSize
+	Elapsed time.Duration `json:"elapsed"`
+	Done    bool          `json:"done"`
+}
+
+// RowsPerSec returns the average rows per second
+func (p Progress) RowsPerSec() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Rows) / p.Elapsed.Seconds()
+}
+
+// BytesPerSec returns the average bytes per second
+func (p Progress) BytesPerSec() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / p.Elapsed.Seconds()
+}
+
+// rowSize returns the approximate size of a row, in bytes
+func rowSize(row []interface{}) (size uint64) {
+	for _, val := range row {
+		switch v := val.(type) {
+		case nil:
+		case string:
+			size += uint64(len(v))
+		case []byte:
+			size += uint64(len(v))
+		case bool, int8, uint8:
+			size++
+		case int16, uint16:
+			size += 2
+		case int32, uint32, float32:
+			size += 4
+		case int, int64, uint, uint64, float64, time.Time:
+			size += 8
+		default:
+			size += uint64(len(cast.ToString(v)))
+		}
+	}
+	return
+}
+
+// Progress returns the rows and bytes pushed so far, since the stream creation
+func (ds *Datastream) Progress() Progress {
+	if ds.state == nil {
+		return Progress{}
+	}
+
+	p := Progress{
+		Rows:    atomic.LoadUint64(&ds.state.rows),
+		Bytes:   atomic.LoadUint64(&ds.state.bytes),
+		Elapsed: time.Since(ds.state.start),
+	}
+
+	select {
+	case <-ds.state.done:
+		p.Done = true
+	default:
+	}
+	return p
+}
+
+// OnProgress calls fn with the progress of the stream every interval,
+// and a last time once the stream is closed (with Done true).
+// The returned channel is closed after the last call.
+func (ds *Datastream) OnProgress(interval time.Duration, fn func(p Progress)) <-chan struct{} {
+	finished := make(chan struct{})
+	if ds.state == nil {
+		close(finished)
+		return finished
+	}
+
+	src := *ds
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn(src.Progress())
+			case <-src.state.done:
+				fn(src.Progress())
+				return
+			}
+		}
+	}()
+
+	return finished
+}
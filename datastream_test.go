@@ -0,0 +1,134 @@
+package gxutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatastreamPipeline(t *testing.T) {
+	data := Dataset{
+		Columns: []Column{
+			{Position: 1, Name: "id", Type: "string"},
+			{Position: 2, Name: "name", Type: "string"},
+			{Position: 3, Name: "amount", Type: "string"},
+		},
+		Rows: [][]interface{}{
+			{"1", "alice", "10.5"},
+			{"2", "bob", "20"},
+			{"3", "carol", "7.25"},
+			{"4", "dave", "1"},
+		},
+	}
+
+	ds := data.Stream()
+	ds = ds.Filter(func(row []interface{}) bool { return row[0] != "2" })
+	ds = ds.Map(func(row []interface{}) ([]interface{}, error) {
+		return []interface{}{row[0], strings.ToUpper(row[1].(string)), row[2]}, nil
+	})
+
+	ds, err := ds.CastColumns(map[string]string{"ID": "integer", "amount": "decimal"})
+	assert.NoError(t, err)
+
+	ds, err = ds.RenameColumns(map[string]string{"name": "first_name"})
+	assert.NoError(t, err)
+
+	ds = ds.AddComputedColumn(
+		Column{Name: "double_amount", Type: "decimal"},
+		func(row []interface{}) (interface{}, error) { return row[2].(Decimal).Float64() * 2, nil },
+	)
+
+	ds, err = ds.SelectColumns("double_amount", "id", "first_name")
+	assert.NoError(t, err)
+
+	ds = ds.Limit(2)
+
+	result := ds.Collect()
+	assert.NoError(t, ds.Err())
+	assert.Equal(t, []string{"double_amount", "id", "first_name"}, result.GetFields())
+	assert.EqualValues(t, 3, result.Columns[2].Position)
+	assert.Equal(t, "integer", result.Columns[1].Type)
+	assert.Equal(t, [][]interface{}{
+		{21.0, int64(1), "ALICE"},
+		{14.5, int64(3), "CAROL"},
+	}, result.Rows)
+
+	ds = data.Stream()
+	_, err = ds.SelectColumns("missing")
+	assert.Error(t, err)
+	ds.Cancel()
+
+	ds = data.Stream()
+	ds = ds.Map(func(row []interface{}) ([]interface{}, error) {
+		if row[0] == "3" {
+			return nil, errors.New("bad row")
+		}
+		return row, nil
+	})
+	result = ds.Collect()
+	assert.Len(t, result.Rows, 2)
+	assert.EqualError(t, ds.Err(), "bad row")
+}
+
+func TestDatastreamTee(t *testing.T) {
+	data := Dataset{
+		Columns: []Column{{Position: 1, Name: "id", Type: "integer"}},
+		Rows:    [][]interface{}{{1}, {2}, {3}, {4}, {5}},
+	}
+
+	results := make([]Dataset, 2)
+	ds := data.Stream()
+	err := ds.Tee(
+		func(ds Datastream) error {
+			results[0] = ds.Collect()
+			return nil
+		},
+		func(ds Datastream) error {
+			results[1] = ds.Collect()
+			return nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, data.Rows, results[0].Rows)
+	assert.Equal(t, data.Rows, results[1].Rows)
+
+	// a failing sink cancels the others
+	ds = data.Stream()
+	err = ds.Tee(
+		func(ds Datastream) error {
+			for range ds.Rows {
+			}
+			return ds.Err()
+		},
+		func(ds Datastream) error {
+			<-ds.Rows
+			return errors.New("sink failed")
+		},
+	)
+	assert.EqualError(t, err, "sink failed")
+	assert.Error(t, ds.Context().Err())
+}
+
+func TestDatastreamProgress(t *testing.T) {
+	data := Dataset{
+		Columns: []Column{{Position: 1, Name: "id", Type: "integer"}, {Position: 2, Name: "name", Type: "string"}},
+		Rows:    [][]interface{}{{int64(1), "abc"}, {int64(2), "de"}, {int64(3), nil}},
+	}
+
+	ds := data.Stream()
+	progresses := []Progress{}
+	finished := ds.OnProgress(time.Hour, func(p Progress) {
+		progresses = append(progresses, p)
+	})
+	ds.Collect()
+	<-finished
+
+	assert.Len(t, progresses, 1)
+	assert.True(t, progresses[0].Done)
+	assert.EqualValues(t, 3, progresses[0].Rows)
+	assert.EqualValues(t, 8*3+3+2, progresses[0].Bytes)
+	assert.True(t, ds.Progress().RowsPerSec() > 0)
+}
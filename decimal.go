@@ -0,0 +1,327 @@
+package gxutil
+
+import (
+	"database/sql/driver"
+	"errors"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// Decimal is an exact decimal number, kept in plain notation
+// (e.g. "-1234.5678900000") so that no digit is lost between
+// the source and the target. The zero value is not a number.
+type Decimal string
+
+var decimalRegex = regexp.MustCompile(`^([+-]?)(\d*)(?:\.(\d*))?(?:[eE]([+-]?\d+))?$`)
+
+// maxDecimalExponent bounds the exponents expanded by NewDecimal
+const maxDecimalExponent = 1000
+
+// NewDecimal parses s, e.g. "1234.50", "-.5" or "1.5E-3".
+// The digits are kept as is, trailing zeros included.
+func NewDecimal(s string) (Decimal, error) {
+	m := decimalRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || m[2]+m[3] == "" {
+		return "", errors.New(F("Invalid decimal '%s'", s))
+	}
+
+	sign, intPart, fracPart := m[1], m[2], m[3]
+	if m[4] != "" {
+		exp, err := strconv.Atoi(m[4])
+		if err != nil || exp > maxDecimalExponent || exp < -maxDecimalExponent {
+			return "", errors.New(F("Invalid decimal '%s', exponent out of range", s))
+		}
+
+		// move the decimal point
+		digits := intPart + fracPart
+		point := len(intPart) + exp
+		if point <= 0 {
+			intPart, fracPart = "0", strings.Repeat("0", -point)+digits
+		} else if point >= len(digits) {
+			intPart, fracPart = digits+strings.Repeat("0", point-len(digits)), ""
+		} else {
+			intPart, fracPart = digits[:point], digits[point:]
+		}
+	}
+
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	if sign == "+" || strings.Trim(intPart+fracPart, "0") == "" {
+		sign = ""
+	}
+
+	if fracPart == "" {
+		return Decimal(sign + intPart), nil
+	}
+	return Decimal(sign + intPart + "." + fracPart), nil
+}
+
+// toDecimal converts a number, or a string of a number, to a Decimal
+func toDecimal(val interface{}) (Decimal, bool) {
+	var s string
+	switch v := val.(type) {
+	case nil:
+		return "", false
+	case Decimal:
+		return v, v != ""
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return "", false
+		}
+		s = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		s = cast.ToString(v)
+	}
+
+	d, err := NewDecimal(s)
+	return d, err == nil
+}
+
+// parts returns the signed integer part and the fractional part
+func (d Decimal) parts() (intPart string, fracPart string) {
+	s := string(d)
+	if i := strings.Index(s, "."); i > -1 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// String returns the plain notation of d
+func (d Decimal) String() string {
+	return string(d)
+}
+
+// Float64 returns the nearest float64 of d
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(string(d), 64)
+	return f
+}
+
+// Rat returns d as a big.Rat, for exact arithmetic (nil if d is invalid)
+func (d Decimal) Rat() *big.Rat {
+	r, ok := new(big.Rat).SetString(string(d))
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+// Scale returns the number of digits after the decimal point
+func (d Decimal) Scale() int {
+	_, fracPart := d.parts()
+	return len(fracPart)
+}
+
+// Precision returns the number of digits, as in numeric(precision, scale)
+func (d Decimal) Precision() int {
+	intPart, fracPart := d.parts()
+	intPart = strings.TrimLeft(intPart, "-0")
+	return len(intPart) + len(fracPart)
+}
+
+// Unscaled returns d * 10^scale as an integer,
+// rounded half away from zero if d has more digits than scale
+func (d Decimal) Unscaled(scale int) *big.Int {
+	intPart, fracPart := d.parts()
+	neg := strings.HasPrefix(intPart, "-")
+	intPart = strings.TrimPrefix(intPart, "-")
+
+	roundUp := false
+	if scale < 0 {
+		scale = 0
+	}
+	if len(fracPart) > scale {
+		roundUp = fracPart[scale] >= '5'
+		fracPart = fracPart[:scale]
+	} else {
+		fracPart += strings.Repeat("0", scale-len(fracPart))
+	}
+
+	n, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	if roundUp {
+		n.Add(n, big.NewInt(1))
+	}
+	if neg {
+		n.Neg(n)
+	}
+	return n
+}
+
+// Value implements driver.Valuer, binding d as text
+func (d Decimal) Value() (driver.Value, error) {
+	return string(d), nil
+}
+
+// MarshalJSON writes d as a JSON number, with all its digits
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d == "" {
+		return []byte("null"), nil
+	}
+	return []byte(d), nil
+}
+
+// unscaledFit returns the unscaled value of d with scale, or an error
+// if it has more digits than precision, as in DECIMAL(precision, scale),
+// or non-zero digits past scale (they are not rounded)
+func (d Decimal) unscaledFit(precision, scale int) (*big.Int, error) {
+	if _, fracPart := d.parts(); len(fracPart) > scale && strings.TrimRight(fracPart[scale:], "0") != "" {
+		return nil, errors.New(F("value %s has more decimals than DECIMAL(%d,%d)", d, precision, scale))
+	}
+	unscaled := d.Unscaled(scale)
+	if len(new(big.Int).Abs(unscaled).String()) > precision {
+		return nil, errors.New(F("value %s does not fit DECIMAL(%d,%d)", d, precision, scale))
+	}
+	return unscaled, nil
+}
+
+// unscaledFromBytes returns the unscaled value of a decimal stored as
+// big-endian two's complement bytes
+func unscaledFromBytes(b []byte) *big.Int {
+	unscaled := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return unscaled
+}
+
+// decimalFromUnscaled returns unscaled / 10^scale, e.g. the value of
+// a DECIMAL(p, scale) column of a Parquet file
+func decimalFromUnscaled(unscaled *big.Int, scale int) Decimal {
+	digits := new(big.Int).Abs(unscaled).String()
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return Decimal(sign + digits + strings.Repeat("0", -scale))
+	}
+
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	point := len(digits) - scale
+	return Decimal(sign + digits[:point] + "." + digits[point:])
+}
+
+// defaultDecimalScale is the scale of the decimals of unknown
+// precision, when no values are buffered to find it
+const defaultDecimalScale = 9
+
+// decimalSize returns the precision and scale of the decimal column i,
+// written with a fixed size. Of unknown precision, it is 38 with the
+// largest scale of the buffered values.
+func decimalSize(col Column, i int, buffer [][]interface{}) (precision, scale int) {
+	if col.Precision > 0 {
+		return col.Precision, col.Scale
+	}
+
+	scale, found := 0, false
+	for _, row := range buffer {
+		if i >= len(row) {
+			continue
+		}
+		if d, ok := toDecimal(row[i]); ok {
+			found = true
+			if d.Scale() > scale {
+				scale = d.Scale()
+			}
+		}
+	}
+	if !found {
+		scale = defaultDecimalScale
+	} else if scale > 37 {
+		scale = 37
+	}
+	return 38, scale
+}
+
+// floatingTypes are the database types of floating point values
+var floatingTypes = map[string]bool{
+	"float": true, "float4": true, "float8": true, "real": true, "double": true,
+	"double precision": true, "binary_float": true, "binary_double": true,
+}
+
+// floatColumn returns true if a decimal column of unknown precision has
+// floating point values: of a floating source type, or buffered as float32
+// or float64 only. They are written as doubles, not decimals.
+func floatColumn(col Column, i int, buffer [][]interface{}) bool {
+	if col.Type != "decimal" || col.Precision > 0 {
+		return false
+	} else if col.floating {
+		return true
+	}
+
+	floats := false
+	for _, row := range buffer {
+		if i >= len(row) {
+			continue
+		}
+		switch row[i].(type) {
+		case nil:
+		case float32, float64:
+			floats = true
+		default:
+			return false
+		}
+	}
+	return floats
+}
+
+// sampleDecimals buffers the first rows of ds when it has decimal columns
+// of unknown precision and no buffer yet, so that their size and floating
+// values are known before the schema is written. The rows are replayed.
+func sampleDecimals(ds *Datastream) (Datastream, error) {
+	sample := false
+	for _, col := range ds.Columns {
+		if col.Type == "decimal" && col.Precision <= 0 {
+			sample = true
+		}
+	}
+	if !sample || len(ds.Buffer) > 0 || SampleSize <= 0 {
+		return *ds, nil
+	}
+
+	buffer := [][]interface{}{}
+	for row := range ds.Rows {
+		buffer = append(buffer, row)
+		if len(buffer) == SampleSize {
+			break
+		}
+	}
+
+	if err := ds.Err(); err != nil {
+		return *ds, Error(err, "Could not read sample of decimal values")
+	}
+
+	dsOut := ds.pipeBuffer(
+		ds.Columns, buffer,
+		func(row []interface{}) ([]interface{}, bool, error) {
+			return row, false, nil
+		},
+	)
+	dsOut.Buffer = buffer
+
+	return dsOut, nil
+}
+
+// decimalLength returns the bytes holding the unscaled values of
+// a precision, with their sign (two's complement)
+func decimalLength(precision int) int {
+	maxUnscaled := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)
+	return maxUnscaled.BitLen()/8 + 1
+}
@@ -0,0 +1,70 @@
+package gxutil
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecimal(t *testing.T) {
+	for s, expected := range map[string]string{
+		"1234.50":   "1234.50",
+		"+001.5":    "1.5",
+		"-.5":       "-0.5",
+		"-0.00":     "0.00",
+		"1.5E-3":    "0.0015",
+		"1.50e+1":   "15.0",
+		"12e3":      "12000",
+		"123456789": "123456789",
+	} {
+		d, err := NewDecimal(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, Decimal(expected), d, s)
+	}
+
+	for _, s := range []string{"", ".", "1.2.3", "abc", "1e99999", "3/4"} {
+		_, err := NewDecimal(s)
+		assert.Error(t, err, s)
+	}
+
+	// numeric(38,10) round-trips exactly
+	val := "1234567890123456789012345678.0123456789"
+	d := parseDriverString(val)
+	assert.Equal(t, Decimal(val), d)
+	assert.Equal(t, val, toString(d))
+	assert.Equal(t, Decimal(val), castVal(val, "decimal"))
+	assert.Equal(t, 38, d.(Decimal).Precision())
+	assert.Equal(t, 10, d.(Decimal).Scale())
+
+	jsonBytes, err := json.Marshal([]interface{}{d})
+	assert.NoError(t, err)
+	assert.Equal(t, "["+val+"]", string(jsonBytes))
+
+	expected, _ := new(big.Int).SetString("12345678901234567890123456780123456789", 10)
+	assert.Equal(t, expected, d.(Decimal).Unscaled(10))
+	assert.Equal(t, big.NewInt(-125), Decimal("-1.245").Unscaled(2))
+	assert.Equal(t, big.NewInt(1500), Decimal("1.5").Unscaled(3))
+
+	unscaled, err := Decimal("-1.2500").unscaledFit(4, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(-125), unscaled)
+	_, err = Decimal("1.125").unscaledFit(10, 2) // not rounded
+	assert.Error(t, err)
+	_, err = Decimal("123.4").unscaledFit(4, 2)
+	assert.Error(t, err)
+	assert.Equal(t, new(big.Rat).SetFrac64(-1, 8), Decimal("-0.125").Rat())
+
+	assert.Equal(t, int64(15), parseDriverString("15"))
+	assert.Equal(t, 0.1, processVal(float32(0.1)))
+	assert.Equal(t, Decimal("0.1"), castVal(0.1, "decimal"))
+	assert.Equal(t, int64(2), castVal(Decimal("2.7"), "integer"))
+	assert.Nil(t, castVal("x", "decimal"))
+
+	stats := ColumnStats{}
+	stats.add(Decimal("10.125"))
+	stats.add(int64(3))
+	assert.Equal(t, "decimal", stats.generalType())
+	assert.Equal(t, 3, stats.maxDecLen)
+}
@@ -0,0 +1,205 @@
+package gxutil
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// replacementChar replaces the invalid sequences read, in UTF-8
+const replacementChar = "\uFFFD"
+
+// textEncoding is a character encoding of the files
+type textEncoding struct {
+	read  encoding.Encoding // nil for UTF-8, the UTF-16 ones detect the BOM
+	write encoding.Encoding // nil for UTF-8
+	bom   bool              // a BOM is written
+}
+
+// getEncoding returns the encoding named name, e.g. "latin1" or "UTF-16LE"
+func getEncoding(name string) (enc textEncoding, err error) {
+	key := strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(name))
+	switch key {
+	case "", "utf8":
+	case "latin1", "iso88591":
+		enc = textEncoding{read: charmap.ISO8859_1, write: charmap.ISO8859_1}
+	case "windows1252", "cp1252":
+		enc = textEncoding{read: charmap.Windows1252, write: charmap.Windows1252}
+	case "utf16", "utf16le":
+		enc = textEncoding{
+			read:  unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+			write: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+			bom:   key == "utf16",
+		}
+	case "utf16be":
+		enc = textEncoding{
+			read:  unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+			write: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+		}
+	case "shiftjis", "sjis":
+		enc = textEncoding{read: japanese.ShiftJIS, write: japanese.ShiftJIS}
+	default:
+		err = errors.New(F("Unsupported encoding '%s' (utf-8, latin1, windows-1252, utf-16, utf-16le, utf-16be or shift-jis)", name))
+	}
+	return
+}
+
+// newDecodeReader returns r decoded to UTF-8 from opts.Encoding. A UTF-8
+// reader starting with a UTF-16 BOM is decoded as UTF-16. The invalid
+// sequences fail the read, or are replaced if opts.ReplaceInvalid
+// (and counted in replaced).
+func newDecodeReader(r io.Reader, opts CSVOptions, replaced *uint64) (io.Reader, error) {
+	enc, err := getEncoding(opts.Encoding)
+	if err != nil {
+		return r, err
+	}
+
+	if enc.read == nil {
+		bReader := bufio.NewReader(r)
+		if bom, err := bReader.Peek(2); err == nil && (string(bom) == "\xff\xfe" || string(bom) == "\xfe\xff") {
+			enc, _ = getEncoding("utf-16")
+		}
+		r = bReader
+	}
+
+	validator := &invalidTransformer{
+		encoding: opts.Encoding,
+		decoded:  enc.read != nil,
+		replace:  opts.ReplaceInvalid,
+		replaced: replaced,
+	}
+	if enc.read == nil {
+		return transform.NewReader(r, validator), nil
+	}
+	return transform.NewReader(r, transform.Chain(enc.read.NewDecoder(), validator)), nil
+}
+
+// invalidTransformer checks that UTF-8 text is valid, replacing the
+// invalid sequences if replace. Decoded text has U+FFFD in their place.
+type invalidTransformer struct {
+	encoding string
+	decoded  bool
+	replace  bool
+	replaced *uint64
+}
+
+// Transform implements transform.Transformer
+func (t *invalidTransformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		r, size := rune(src[nSrc]), 1
+		if r >= utf8.RuneSelf {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r, size = utf8.DecodeRune(src[nSrc:])
+		}
+
+		out := src[nSrc : nSrc+size]
+		invalid := r == utf8.RuneError && (size == 1 || t.decoded)
+		if invalid {
+			if !t.replace {
+				encoding := t.encoding
+				if encoding == "" {
+					encoding = "utf-8"
+				}
+				return nDst, nSrc, errors.New(F("Invalid %s sequence, the data could have another encoding (or replace the invalid sequences)", encoding))
+			}
+			out = []byte(replacementChar)
+		}
+
+		if nDst+len(out) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], out)
+		nSrc += size
+
+		if invalid && t.replaced != nil {
+			atomic.AddUint64(t.replaced, 1)
+		}
+	}
+	return nDst, nSrc, nil
+}
+
+// Reset implements transform.Transformer
+func (t *invalidTransformer) Reset() {}
+
+// textEncoder encodes the written text from UTF-8 to an encoding
+type textEncoder struct {
+	encoder  *encoding.Encoder // nil for UTF-8
+	name     string
+	bom      bool
+	replace  bool
+	replaced *uint64
+}
+
+func newTextEncoder(opts CSVOptions, replaced *uint64) (*textEncoder, error) {
+	enc, err := getEncoding(opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	te := &textEncoder{name: opts.Encoding, bom: enc.bom, replace: opts.ReplaceInvalid, replaced: replaced}
+	if enc.write != nil {
+		te.encoder = enc.write.NewEncoder()
+	}
+	return te, nil
+}
+
+// bomString returns the encoded BOM to write first, if any
+func (te *textEncoder) bomString() string {
+	if !te.bom {
+		return ""
+	}
+	s, _ := te.encoder.String("\uFEFF")
+	return s
+}
+
+// String returns s encoded. The invalid sequences and the characters
+// that cannot be encoded fail, or are replaced with "?" if replace.
+func (te *textEncoder) String(s string) (string, error) {
+	if te.encoder == nil {
+		if !te.replace || utf8.ValidString(s) {
+			return s, nil
+		}
+	} else if encoded, err := te.encoder.String(s); err == nil {
+		return encoded, nil
+	}
+
+	// by character, to find the ones to replace
+	out := strings.Builder{}
+	for i, r := range s {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		char := s[i : i+size]
+
+		encoded, ok := char, r != utf8.RuneError || size > 1
+		if ok && te.encoder != nil {
+			var err error
+			encoded, err = te.encoder.String(char)
+			ok = err == nil
+		}
+
+		if !ok {
+			if !te.replace {
+				return "", errors.New(F("Could not encode %q to %s", char, te.name))
+			}
+			encoded = "?"
+			if te.encoder != nil {
+				encoded, _ = te.encoder.String("?")
+			}
+			if te.replaced != nil {
+				atomic.AddUint64(te.replaced, 1)
+			}
+		}
+		out.WriteString(encoded)
+	}
+	return out.String(), nil
+}
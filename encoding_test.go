@@ -0,0 +1,86 @@
+package gxutil
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVEncoding(t *testing.T) {
+	readAll := func(text string, opts CSVOptions) (Dataset, uint64, error) {
+		csv1 := CSV{Reader: strings.NewReader(text), Options: opts}
+		ds, err := csv1.ReadStream()
+		if err != nil {
+			return Dataset{}, 0, err
+		}
+		data := ds.Collect()
+		return data, csv1.Replaced(), ds.Err()
+	}
+
+	for _, c := range []struct {
+		encoding string
+		text     string
+		expected string
+	}{
+		{"latin1", "name\nJos\xe9\n", "José"},
+		{"windows-1252", "name\n\x80 5\n", "€ 5"},
+		{"shift-jis", "name\n\x93\xfa\x96\x7b\n", "日本"},
+		{"utf-16be", "\x00n\x00a\x00m\x00e\x00\n\x00\xe9\x00\n", "é"},
+		{"", "\xff\xfen\x00a\x00m\x00e\x00\n\x00\xe9\x00\n\x00", "é"}, // BOM detected
+		{"utf-16le", "\xfe\xff\x00n\x00a\x00m\x00e\x00\n\x00\xe9\x00\n", "é"},
+	} {
+		data, _, err := readAll(c.text, CSVOptions{Encoding: c.encoding})
+		if assert.NoError(t, err, c.encoding) && assert.Len(t, data.Rows, 1, c.encoding) {
+			assert.Equal(t, []string{"name"}, data.GetFields(), c.encoding)
+			assert.Equal(t, c.expected, data.Rows[0][0], c.encoding)
+		}
+	}
+
+	// invalid sequences fail, or are replaced and counted
+	_, _, err := readAll("name\nJos\xe9\n", CSVOptions{})
+	assert.Error(t, err)
+	data, replaced, err := readAll("name\nJos\xe9\nb\xffd\xfe\n", CSVOptions{ReplaceInvalid: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Jos\uFFFD", data.Rows[0][0])
+		assert.Equal(t, "b\uFFFDd\uFFFD", data.Rows[1][0])
+		assert.EqualValues(t, 3, replaced)
+	}
+	_, replaced, err = readAll("name\n\x81\x20\n", CSVOptions{Encoding: "shift-jis", ReplaceInvalid: true})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, replaced)
+
+	assert.Error(t, CSVOptions{Encoding: "ebcdic"}.Validate())
+
+	// written in the encoding
+	data = Dataset{
+		Columns: []Column{{Name: "name", Type: "string"}},
+		Rows:    [][]interface{}{{"José"}, {"日本"}},
+	}
+
+	csvPath := "test/encoding.csv"
+	defer os.Remove(csvPath)
+	csv1 := CSV{Path: csvPath, Options: CSVOptions{Encoding: "latin1"}}
+	_, err = csv1.WriteStream(data.Stream())
+	assert.Error(t, err)
+
+	csv1 = CSV{Path: csvPath, Options: CSVOptions{Encoding: "latin1", ReplaceInvalid: true}}
+	_, err = csv1.WriteStream(data.Stream())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, csv1.Replaced())
+	csvBytes, _ := ioutil.ReadFile(csvPath)
+	assert.Equal(t, "name\nJos\xe9\n??\n", string(csvBytes))
+
+	csv1 = CSV{Path: csvPath, Options: CSVOptions{Encoding: "utf-16"}}
+	_, err = csv1.WriteStream(data.Stream())
+	assert.NoError(t, err)
+	csvBytes, _ = ioutil.ReadFile(csvPath)
+	assert.True(t, strings.HasPrefix(string(csvBytes), "\xff\xfen\x00a\x00"))
+
+	data2, _, err := readAll(string(csvBytes), CSVOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, data.Rows, data2.Rows)
+	}
+}
@@ -156,12 +156,13 @@ func strFloat64(val float64) string {
 
 // Log : print text
 func Log(text string) {
-	fmt.Fprintf(os.Stderr, "%s -- %s\n", time.Now().Format("2006-01-02 15:04:05"), text)
+	fmt.Fprintf(os.Stderr, "%s -- %s\n", time.Now().Format("2006-01-02 15:04:05"), Redact(text))
 }
 
 // LogC : print text in specified color
 func LogC(text string, col string, w io.Writer) {
 	var textColored string
+	text = Redact(text)
 	timeColored := color.CyanString(time.Now().Format("2006-01-02 15:04:05"))
 	switch col {
 	case "red":
@@ -215,14 +216,14 @@ func LogError(E error) {
 func LogErrorExit(E error) {
 	if E != nil {
 		LogCRedErr(E.Error())
-		log.Fatal(Propagate(E, E.Error()))
+		log.Fatal(Redact(Propagate(E, E.Error()).Error()))
 	}
 }
 
 // LogErrorMail handles logging of an error and mail it to self
 func LogErrorMail(E error) {
 	LogCRedErr(E.Error())
-	SendMail(SMTPUser, []string{AlertEmail}, "Error | "+os.Args[0], E.Error())
+	SendMail(SMTPUser, []string{AlertEmail}, "Error | "+os.Args[0], Redact(E.Error()))
 }
 
 // LogIfError handles logging of an error if it i not nil, useful for reporting
@@ -267,7 +268,7 @@ func Panic(e error, msg string) {
 
 // Error returns stacktrace error with message
 func Error(e error, msg string) error {
-	return stacktrace.Propagate(e, msg, 3)
+	return stacktrace.Propagate(redactError(e), Redact(msg), 3)
 }
 
 // Tee prints stream of text of reader
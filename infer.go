@@ -0,0 +1,171 @@
+package gxutil
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InferOptions configures how strings are parsed into typed values,
+// when reading files and inferring column types
+type InferOptions struct {
+	DateLayouts        []string       // layouts of the dates / datetimes, tried in order
+	Location           *time.Location // timezone of the dates without offset (default UTC)
+	Booleans           bool           // parse "true" / "false" as booleans
+	KeepLeadingZeros   bool           // numbers with leading zeros (zip codes, ids) stay strings
+	ThousandsSeparator string         // e.g. "," in "1,234.5"
+	DecimalSeparator   string         // default "."
+	NullTokens         []string       // values parsed as null, e.g. "NULL", "\N", "NA"
+}
+
+// DefaultDateLayouts are the date / datetime layouts tried by default
+var DefaultDateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.000",
+	"2006-01-02T15:04:05.000Z",
+	"2006-01-02 15:04:05Z07:00",
+	time.RFC3339,
+	"01-JAN-02",
+	"01-JAN-02 15:04:05",
+}
+
+// DefaultInferOptions are the options of ParseString, CSV.ReadStream
+// and InferColumnTypes
+var DefaultInferOptions = NewInferOptions()
+
+// driverInferOptions are the default options, for the text values of
+// database drivers: the null tokens and separators of DefaultInferOptions
+// are for files only, a varchar "NA" stays "NA"
+var driverInferOptions = NewInferOptions()
+
+var leadingZeroRegex = regexp.MustCompile(`^[+-]?0\d`)
+
+// NewInferOptions returns the default inference options
+func NewInferOptions() *InferOptions {
+	return &InferOptions{
+		DateLayouts:      append([]string{}, DefaultDateLayouts...),
+		Location:         time.UTC,
+		DecimalSeparator: ".",
+	}
+}
+
+// ParseString returns the typed value of s: nil for a null token,
+// then int64, float64, time.Time, bool (if enabled) or s itself
+func (o *InferOptions) ParseString(s string) interface{} {
+	if o.isNull(s) {
+		return nil
+	}
+
+	if o.KeepLeadingZeros && leadingZeroRegex.MatchString(s) {
+		return s
+	}
+
+	if num, ok := o.parseNumber(s); ok {
+		return num
+	}
+
+	if t, ok := o.parseTime(s); ok {
+		return t
+	}
+
+	// boolean
+	// off by default, causes issues in SQLite and Oracle
+	if o.Booleans {
+		if b, ok := o.parseBool(s); ok {
+			return b
+		}
+	}
+
+	return s
+}
+
+func (o *InferOptions) isNull(s string) bool {
+	for _, token := range o.NullTokens {
+		if s == token {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeNumber removes the thousands separators of s and
+// replaces the decimal separator with "."
+func (o *InferOptions) normalizeNumber(s string) (string, bool) {
+	decimalSep := o.DecimalSeparator
+	if decimalSep == "" {
+		decimalSep = "."
+	}
+
+	if o.ThousandsSeparator != "" && strings.Contains(s, o.ThousandsSeparator) {
+		intPart := s
+		decPart := ""
+		if i := strings.Index(s, decimalSep); i > -1 {
+			intPart, decPart = s[:i], s[i:]
+		}
+
+		// groups of 3 digits, except the first
+		groups := strings.Split(strings.TrimLeft(intPart, "+-"), o.ThousandsSeparator)
+		for i, group := range groups {
+			if (i == 0 && (len(group) == 0 || len(group) > 3)) || (i > 0 && len(group) != 3) {
+				return s, false
+			}
+		}
+		s = strings.Replace(intPart, o.ThousandsSeparator, "", -1) + decPart
+	}
+
+	if decimalSep != "." {
+		if strings.Contains(s, ".") {
+			return s, false
+		}
+		s = strings.Replace(s, decimalSep, ".", 1)
+	}
+
+	return s, true
+}
+
+// parseNumber parses s as an int64 or a float64
+func (o *InferOptions) parseNumber(s string) (interface{}, bool) {
+	s, ok := o.normalizeNumber(s)
+	if !ok {
+		return nil, false
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return i, true
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil {
+		return f, true
+	}
+
+	return nil, false
+}
+
+// parseTime parses s with the date layouts
+func (o *InferOptions) parseTime(s string) (time.Time, bool) {
+	loc := o.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	for _, layout := range o.DateLayouts {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (o *InferOptions) parseBool(s string) (bool, bool) {
+	if strings.EqualFold(s, "true") {
+		return true, true
+	} else if strings.EqualFold(s, "false") {
+		return false, true
+	}
+	return false, false
+}
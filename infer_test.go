@@ -0,0 +1,51 @@
+package gxutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInferOptions(t *testing.T) {
+	opts := NewInferOptions()
+	assert.Equal(t, int64(123), opts.ParseString("0123"))
+	assert.Equal(t, "true", opts.ParseString("true"))
+	assert.Equal(t, "NULL", opts.ParseString("NULL"))
+	assert.Equal(t, "1,234.5", opts.ParseString("1,234.5"))
+
+	opts.KeepLeadingZeros = true
+	opts.Booleans = true
+	opts.NullTokens = []string{"", "NULL", `\N`, "NA"}
+	opts.ThousandsSeparator = ","
+	assert.Equal(t, "0123", opts.ParseString("0123"))
+	assert.Equal(t, 0.5, opts.ParseString("0.5"))
+	assert.Equal(t, true, opts.ParseString("TRUE"))
+	assert.Nil(t, opts.ParseString(`\N`))
+	assert.Nil(t, opts.ParseString(""))
+	assert.Equal(t, 1234.5, opts.ParseString("1,234.5"))
+	assert.Equal(t, int64(-1234567), opts.ParseString("-1,234,567"))
+	assert.Equal(t, "12,34", opts.ParseString("12,34"))
+
+	opts.ThousandsSeparator = "."
+	opts.DecimalSeparator = ","
+	assert.Equal(t, 1234.5, opts.ParseString("1.234,5"))
+	assert.Equal(t, 0.25, opts.ParseString("0,25"))
+
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	opts.Location = loc
+	opts.DateLayouts = append([]string{"02/01/2006"}, opts.DateLayouts...)
+	assert.Equal(t, time.Date(2020, 3, 25, 0, 0, 0, 0, loc), opts.ParseString("25/03/2020"))
+
+	// honoured when casting
+	DefaultInferOptions = opts
+	defer func() { DefaultInferOptions = NewInferOptions() }()
+	assert.Equal(t, int64(1234), castVal("1.234", "integer"))
+	assert.Nil(t, castVal("NA", "string"))
+	assert.Equal(t, time.Date(2020, 3, 25, 0, 0, 0, 0, loc), castVal("25/03/2020", "datetime"))
+
+	// but not for the values of database drivers
+	assert.Equal(t, "NA", processVal([]byte("NA")))
+	assert.Equal(t, Decimal("1.234"), processVal([]byte("1.234")))
+}
@@ -0,0 +1,129 @@
+package gxutil
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// FlattenOptions configures how the nested JSON documents are flattened
+// into columns. The zero value keeps the nested objects and arrays as
+// JSON strings.
+type FlattenOptions struct {
+	// MaxDepth is the number of levels of nested objects flattened into
+	// columns named with their path, e.g. "address.city" (-1 for all).
+	// The deeper objects are kept as JSON strings.
+	MaxDepth int
+
+	// Separator joins the keys of the flattened column names, default "."
+	Separator string
+
+	// Explode is the flattened name of an array exploded into a row per
+	// element, e.g. "order.items". The rows have the parent key and the
+	// element, flattened under the name of the array (e.g. "order.items.sku").
+	// The other arrays are kept as JSON strings.
+	Explode string
+
+	// ParentKey is the flattened name of the column of the document
+	// repeated in its exploded rows, e.g. "order.id". Default "_parent",
+	// the line number of the document.
+	ParentKey string
+}
+
+func (o FlattenOptions) separator() string {
+	if o.Separator == "" {
+		return "."
+	}
+	return o.Separator
+}
+
+// flatten returns the flattened record of a document, or the records
+// of the elements of the exploded array (line is the document line)
+func (o FlattenOptions) flatten(doc jsonRecord, line int) ([]jsonRecord, error) {
+	if o.MaxDepth == 0 && o.Explode == "" {
+		return []jsonRecord{doc}, nil
+	}
+
+	flat := newJSONRecord()
+	if err := o.flattenInto(&flat, doc, "", 0); err != nil {
+		return nil, err
+	}
+	if o.Explode == "" {
+		return []jsonRecord{flat}, nil
+	}
+
+	// the rows of the exploded array
+	parentKey := o.ParentKey
+	var parentVal interface{} = int64(line)
+	if parentKey == "" {
+		parentKey = "_parent"
+	} else {
+		parentVal = flat.values[parentKey]
+	}
+
+	raw, _ := flat.values[o.Explode].(json.RawMessage)
+	if len(raw) == 0 || raw[0] != '[' {
+		return nil, nil // no elements
+	}
+
+	elements := []json.RawMessage{}
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		return nil, err
+	}
+
+	records := make([]jsonRecord, len(elements))
+	for i, element := range elements {
+		records[i] = newJSONRecord()
+		records[i].set(parentKey, parentVal)
+
+		if element[0] == '{' {
+			elemDoc, err := decodeJSONRecord(element)
+			if err != nil {
+				return nil, err
+			}
+			if err = o.flattenInto(&records[i], elemDoc, o.Explode+o.separator(), 0); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		val, err := decodeJSONValue(element)
+		if err != nil {
+			return nil, err
+		}
+		records[i].set(o.Explode, val)
+	}
+	return records, nil
+}
+
+// onPath returns true if the object named name is on the path of the
+// exploded array or of the parent key, flattened at any depth
+func (o FlattenOptions) onPath(name string) bool {
+	prefix := name + o.separator()
+	return (o.Explode != "" && strings.HasPrefix(o.Explode, prefix)) ||
+		(o.ParentKey != "" && strings.HasPrefix(o.ParentKey, prefix))
+}
+
+// flattenInto sets the values of doc in flat, with the nested objects
+// up to MaxDepth flattened into prefixed names
+func (o FlattenOptions) flattenInto(flat *jsonRecord, doc jsonRecord, prefix string, depth int) error {
+	for _, key := range doc.keys {
+		name := prefix + key
+		val := doc.values[key]
+
+		raw, ok := val.(json.RawMessage)
+		if ok && raw[0] == '{' && (o.MaxDepth < 0 || depth < o.MaxDepth || o.onPath(name)) {
+			child, err := decodeJSONRecord(raw)
+			if err != nil {
+				return errors.New(F("%s: %s", name, err.Error()))
+			}
+			if err = o.flattenInto(flat, child, name+o.separator(), depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		flat.set(name, val)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package gxutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONFlatten(t *testing.T) {
+	text := `{"order": {"id": 10, "customer": {"name": "a", "address": {"city": "x"}}}, "items": [{"sku": "s1", "qty": 2}, {"sku": "s2", "qty": 1, "note": "gift"}]}
+{"order": {"id": 11, "status": "new"}, "items": [], "tags": ["t1"]}
+`
+	read := func(opts FlattenOptions) Dataset {
+		ds, err := (&JSONL{Reader: strings.NewReader(text), Flatten: opts}).ReadStream()
+		if !assert.NoError(t, err) {
+			return Dataset{}
+		}
+		data := ds.Collect()
+		assert.NoError(t, ds.Err())
+		return data
+	}
+
+	// one level, the columns are widened with the keys of the second document
+	data := read(FlattenOptions{MaxDepth: 1})
+	assert.Equal(t, []string{"order.id", "order.customer", "items", "order.status", "tags"}, data.GetFields())
+	if assert.Len(t, data.Rows, 2) {
+		assert.Equal(t, int64(10), data.Records()[0]["order.id"])
+		assert.Equal(t, `{"name":"a","address":{"city":"x"}}`, data.Records()[0]["order.customer"])
+		assert.Equal(t, `[{"sku":"s1","qty":2},{"sku":"s2","qty":1,"note":"gift"}]`, data.Records()[0]["items"])
+		assert.Equal(t, "new", data.Records()[1]["order.status"])
+		assert.Nil(t, data.Records()[0]["tags"])
+	}
+
+	// all levels, with another separator
+	data = read(FlattenOptions{MaxDepth: -1, Separator: "_"})
+	assert.Equal(t, []string{"order_id", "order_customer_name", "order_customer_address_city", "items", "order_status", "tags"}, data.GetFields())
+	assert.Equal(t, "x", data.Records()[0]["order_customer_address_city"])
+
+	// the items exploded, with the key of the order
+	data = read(FlattenOptions{Explode: "items", ParentKey: "order.id"})
+	assert.Equal(t, []string{"order.id", "items.sku", "items.qty", "items.note"}, data.GetFields())
+	assert.Equal(t, [][]interface{}{
+		{int64(10), "s1", int64(2), nil},
+		{int64(10), "s2", int64(1), "gift"},
+	}, data.Rows)
+
+	// the tags exploded, with the line of the document
+	data = read(FlattenOptions{Explode: "tags"})
+	assert.Equal(t, []string{"_parent", "tags"}, data.GetFields())
+	assert.Equal(t, [][]interface{}{{int64(2), "t1"}}, data.Rows)
+}
@@ -0,0 +1,366 @@
+package gxutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// JSONL is a JSON Lines file, one JSON object per line
+type JSONL struct {
+	Path    string
+	Columns []Column
+	File    *os.File
+	Reader  io.Reader
+	Gzip    bool           // compress the written file, as when Path ends with .gz
+	Flatten FlattenOptions // the flattening of the nested documents read
+}
+
+// jsonRecord is a decoded JSON object, with its keys in order
+type jsonRecord struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newJSONRecord() jsonRecord {
+	return jsonRecord{values: map[string]interface{}{}}
+}
+
+// set sets the value of key, added last if new
+func (r *jsonRecord) set(key string, val interface{}) {
+	if _, ok := r.values[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+	r.values[key] = val
+}
+
+// jsonRecordReader reads the JSON objects of a JSON Lines file
+type jsonRecordReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// ReadFlat returns the records of the next object flattened, or io.EOF
+func (jr *jsonRecordReader) ReadFlat(opts FlattenOptions) ([]jsonRecord, error) {
+	record, err := jr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := opts.flatten(record, jr.line)
+	if err != nil {
+		return nil, errors.New(F("line %d: %s", jr.line, err.Error()))
+	}
+	return records, nil
+}
+
+// Read returns the next object, or io.EOF. Empty lines are skipped.
+func (jr *jsonRecordReader) Read() (record jsonRecord, err error) {
+	for {
+		line, err := jr.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return record, err
+		} else if err == io.EOF && len(line) == 0 {
+			return record, io.EOF
+		}
+		jr.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		record, err = decodeJSONRecord(line)
+		if err != nil {
+			return record, errors.New(F("line %d: %s", jr.line, err.Error()))
+		}
+		return record, nil
+	}
+}
+
+// decodeJSONRecord decodes a JSON object, keeping the order of its keys.
+// The values are decoded with decodeJSONValue.
+func decodeJSONRecord(data []byte) (record jsonRecord, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return record, errors.New("not a JSON object")
+	}
+
+	record = newJSONRecord()
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return record, err
+		}
+		key := token.(string)
+
+		var raw json.RawMessage
+		if err = decoder.Decode(&raw); err != nil {
+			return record, err
+		}
+
+		val, err := decodeJSONValue(raw)
+		if err != nil {
+			return record, err
+		}
+		record.set(key, val)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return record, err
+	}
+	return record, nil
+}
+
+// decodeJSONValue returns a JSON value as read from a file: strings,
+// numbers as their text (as in CSV files), bools, nil for null, and
+// json.RawMessage for objects and arrays
+func decodeJSONValue(raw json.RawMessage) (interface{}, error) {
+	switch raw[0] {
+	case 'n':
+		return nil, nil
+	case 't', 'f':
+		return raw[0] == 't', nil
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case '{', '[':
+		compact := bytes.Buffer{}
+		err := json.Compact(&compact, raw)
+		return json.RawMessage(compact.Bytes()), err
+	}
+	return string(raw), nil
+}
+
+// ReadStream returns the read JSON Lines stream, flattened with c.Flatten.
+// The columns are widened with the keys of the records of the first
+// SampleSize rows (the other keys are ignored), and typed from the sample
+// unless c.Columns is set.
+func (c *JSONL) ReadStream() (ds Datastream, err error) {
+	if c.File == nil && c.Reader == nil {
+		file, err := os.Open(c.Path)
+		if err != nil {
+			return ds, Error(err, "os.Open(c.Path)")
+		}
+		c.File = file
+	}
+	if c.Reader == nil {
+		c.Reader = bufio.NewReader(c.File)
+	}
+
+	// decompress if gzip
+	reader, err := Decompress(c.Reader)
+	if err != nil && err != io.EOF {
+		return ds, Error(err, "Decompress(c.Reader)")
+	}
+	jr := &jsonRecordReader{r: bufio.NewReader(reader)}
+
+	// the sample, to find the keys
+	sample := []jsonRecord{}
+	fields := []string{}
+	fieldIndex := map[string]bool{}
+	for len(sample) < SampleSize {
+		records, err := jr.ReadFlat(c.Flatten)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ds, Error(err, "Could not read json lines")
+		}
+
+		for _, record := range records {
+			sample = append(sample, record)
+			for _, key := range record.keys {
+				if !fieldIndex[key] {
+					fieldIndex[key] = true
+					fields = append(fields, key)
+				}
+			}
+		}
+	}
+
+	// typed with c.Columns, or as read until the types are inferred
+	dsRaw := NewDatastream(c.Columns)
+	if dsRaw.Columns == nil {
+		dsRaw.setFields(fields)
+	}
+	columns := dsRaw.Columns
+
+	toRow := func(record jsonRecord) []interface{} {
+		row := make([]interface{}, len(columns))
+		for i, col := range columns {
+			row[i] = record.values[col.Name]
+			if col.Type != "" {
+				row[i] = castVal(row[i], col.Type)
+			}
+		}
+		return row
+	}
+
+	go func() {
+		defer c.File.Close()
+		defer dsRaw.Close()
+
+		for _, record := range sample {
+			if !dsRaw.push(toRow(record)) {
+				return
+			}
+		}
+
+		for {
+			records, err := jr.ReadFlat(c.Flatten)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				dsRaw.SetError(Error(err, "Error reading file"))
+				return
+			}
+
+			for _, record := range records {
+				if !dsRaw.push(toRow(record)) {
+					return
+				}
+			}
+		}
+		c.File = nil
+	}()
+
+	if c.Columns == nil {
+		// collect sample and infer types
+		return dsRaw.InferTypes(SampleSize)
+	}
+
+	return dsRaw, nil
+}
+
+// WriteStream writes the stream as JSON Lines, with the values of the
+// column types: numbers, bools, RFC3339 timestamps, and null for nulls
+func (c *JSONL) WriteStream(ds Datastream) (cnt uint64, err error) {
+	if c.File == nil {
+		file, err := os.Create(c.Path)
+		if err != nil {
+			ds.Cancel()
+			return cnt, err
+		}
+		c.File = file
+	}
+	defer c.File.Close()
+
+	var out io.Writer = c.File
+	copyDone := make(chan error, 1)
+	if c.Gzip || strings.HasSuffix(c.Path, ".gz") {
+		pr, pw := io.Pipe()
+		defer func() {
+			pw.Close()
+			if copyErr := <-copyDone; err == nil && copyErr != nil {
+				err = Error(copyErr, "Could not write gzip file")
+			}
+		}()
+		go func() {
+			_, err := io.Copy(c.File, Compress(pr))
+			pr.CloseWithError(err)
+			copyDone <- err
+		}()
+		out = pw
+	}
+
+	w := bufio.NewWriter(out)
+	fields := make([][]byte, len(ds.Columns))
+	for i, field := range ds.GetFields() {
+		fields[i], _ = json.Marshal(field)
+	}
+
+	line := bytes.Buffer{}
+	for row := range ds.Rows {
+		cnt++
+		line.Reset()
+		line.WriteByte('{')
+		for i, val := range row {
+			if i >= len(fields) {
+				break
+			}
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.Write(fields[i])
+			line.WriteByte(':')
+			line.Write(jsonValue(val, ds.Columns[i]))
+		}
+		line.WriteString("}\n")
+
+		_, err = w.Write(line.Bytes())
+		if err != nil {
+			ds.Cancel()
+			return cnt, Error(err, "Could not write json lines")
+		}
+	}
+
+	if err := ds.Err(); err != nil {
+		return cnt, Error(err, "Upstream stream failed, json lines file is incomplete")
+	}
+	return cnt, w.Flush()
+}
+
+// jsonValue returns the JSON of a value, with the type of its column
+func jsonValue(val interface{}, col Column) []byte {
+	marshal := func(v interface{}) []byte {
+		buf := bytes.Buffer{}
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			return []byte("null")
+		}
+		return bytes.TrimRight(buf.Bytes(), "\n")
+	}
+
+	switch v := val.(type) {
+	case nil:
+		return []byte("null")
+	case Decimal:
+		if v == "" {
+			return []byte("null")
+		}
+		return []byte(v)
+	case float32, float64:
+		if f := cast.ToFloat64(v); math.IsNaN(f) || math.IsInf(f, 0) {
+			return []byte("null")
+		}
+		return marshal(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool:
+		return marshal(v)
+	case time.Time:
+		if col.Type == "date" {
+			return marshal(v.Format("2006-01-02"))
+		}
+		return marshal(normalizeTime(v, col.Type).(time.Time).Format(time.RFC3339Nano))
+	case []byte:
+		return marshal(encodeBinary(v))
+	case json.RawMessage:
+		return v
+	case string:
+		switch col.Type {
+		case "json", "array":
+			if json.Valid([]byte(v)) {
+				return []byte(v)
+			}
+		case "integer", "decimal":
+			if d, err := NewDecimal(v); err == nil {
+				return []byte(d)
+			}
+		case "bool":
+			if b, ok := DefaultInferOptions.parseBool(v); ok {
+				return marshal(b)
+			}
+		}
+		return marshal(v)
+	}
+	return marshal(cast.ToString(val))
+}
@@ -0,0 +1,79 @@
+package gxutil
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONL(t *testing.T) {
+	text := `{"id": 1, "name": "a", "amount": 1.50, "active": true, "created": "2020-03-25T10:30:15.5Z", "tags": ["x", "y"]}
+
+{"id": 2, "name": null, "amount": 12345678901234567890.12, "active": false, "created": "2020-03-26T00:00:00Z", "attrs": {"k": "v"}}
+{"name": "c<d>", "id": 3, "extra": "e"}
+`
+	jsonl := JSONL{Reader: strings.NewReader(text)}
+	ds, err := jsonl.ReadStream()
+	if !assert.NoError(t, err) {
+		return
+	}
+	data := ds.Collect()
+	assert.NoError(t, ds.Err())
+
+	assert.Equal(t, []string{"id", "name", "amount", "active", "created", "tags", "attrs", "extra"}, data.GetFields())
+	types := map[string]string{}
+	for _, col := range data.Columns {
+		types[col.Name] = col.Type
+	}
+	assert.Equal(t, map[string]string{
+		"id": "integer", "name": "string", "amount": "decimal", "active": "bool",
+		"created": "datetime", "tags": "array", "attrs": "json", "extra": "string",
+	}, types)
+
+	if assert.Len(t, data.Rows, 3) {
+		assert.Equal(t, int64(1), data.Rows[0][0])
+		assert.Equal(t, Decimal("12345678901234567890.12"), data.Rows[1][2])
+		assert.Equal(t, true, data.Rows[0][3])
+		assert.Equal(t, time.Date(2020, 3, 25, 10, 30, 15, 5e8, time.UTC), data.Rows[0][4])
+		assert.Equal(t, `["x","y"]`, data.Rows[0][5])
+		assert.Equal(t, `{"k":"v"}`, data.Rows[1][6])
+		assert.Nil(t, data.Rows[1][1])
+		assert.Nil(t, data.Rows[2][2])
+	}
+
+	// written with the column types, and read back
+	jsonPath := "test/test.jsonl.gz"
+	defer os.Remove(jsonPath)
+	cnt, err := (&JSONL{Path: jsonPath}).WriteStream(data.Stream())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+
+	file, _ := os.Open(jsonPath)
+	reader, err := Decompress(file)
+	assert.NoError(t, err)
+	jsonBytes, _ := ioutil.ReadAll(reader)
+	file.Close()
+	lines := strings.Split(string(jsonBytes), "\n")
+	assert.Equal(t, `{"id":1,"name":"a","amount":1.50,"active":true,"created":"2020-03-25T10:30:15.5Z","tags":["x","y"],"attrs":null,"extra":null}`, lines[0])
+	assert.Equal(t, `{"id":3,"name":"c<d>","amount":null,"active":null,"created":null,"tags":null,"attrs":null,"extra":"e"}`, lines[2])
+
+	ds, err = (&JSONL{Path: jsonPath}).ReadStream()
+	if assert.NoError(t, err) {
+		data2 := ds.Collect()
+		assert.Equal(t, data.Rows, data2.Rows)
+	}
+
+	// typed with the given columns
+	jsonl = JSONL{Reader: strings.NewReader(`{"a": "5", "b": 1}`), Columns: []Column{{Name: "b", Type: "string"}, {Name: "a", Type: "integer"}}}
+	ds, err = jsonl.ReadStream()
+	if assert.NoError(t, err) {
+		assert.Equal(t, [][]interface{}{{"1", int64(5)}}, ds.Collect().Rows)
+	}
+
+	_, err = (&JSONL{Reader: strings.NewReader("{\"a\": 1}\n[1, 2]\n")}).ReadStream()
+	assert.Error(t, err)
+}
@@ -1,15 +1,25 @@
 package gxutil
 
 import (
-	// "encoding/csv"
-	// "io"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/spf13/cast"
+	"github.com/xitongsys/parquet-go-source/local"
 	"github.com/xitongsys/parquet-go-source/writerfile"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/layout"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/schema"
 	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
 	"github.com/xitongsys/parquet-go/writer"
-	// "github.com/xitongsys/parquet-go/reader"
 )
 
 // Parquet is a parquet object
@@ -19,57 +29,236 @@ type Parquet struct {
 	File    *os.File
 	PFile   source.ParquetFile
 	Data    *Dataset
+	Select  []string       // the columns read, all if empty
+	Options ParquetOptions // of the written file
 }
 
-func getParquetCsvSchema(columns []Column) []string {
+// ParquetOptions configures the written Parquet files. The zero value
+// is the default: snappy compressed, with 128MB row groups and 8KB pages.
+type ParquetOptions struct {
+	Codec        string // snappy (default), gzip, zstd or none
+	RowGroupSize int64  // the bytes of a row group before it is flushed
+	PageSize     int64  // the bytes of a page of a column
+}
+
+var parquetCodecs = map[string]parquet.CompressionCodec{
+	"":       parquet.CompressionCodec_SNAPPY,
+	"snappy": parquet.CompressionCodec_SNAPPY,
+	"gzip":   parquet.CompressionCodec_GZIP,
+	"zstd":   parquet.CompressionCodec_ZSTD,
+	"none":   parquet.CompressionCodec_UNCOMPRESSED,
+}
+
+// Validate checks the codec and the sizes
+func (o ParquetOptions) Validate() error {
+	if _, ok := parquetCodecs[strings.ToLower(o.Codec)]; !ok {
+		return errors.New(F("Invalid parquet options: codec '%s' is not snappy, gzip, zstd or none", o.Codec))
+	} else if o.RowGroupSize < 0 || o.PageSize < 0 {
+		return errors.New("Invalid parquet options: the row group and page sizes cannot be negative")
+	}
+	return nil
+}
+
+// getParquetSchema returns the schema handler of the written columns.
+// The columns are OPTIONAL unless known not nullable, and typed as:
+// integer INT64, decimal DECIMAL(p,s) (DOUBLE for floats, see floatColumn), date DATE, datetime / timestamptz
+// TIMESTAMP_MICROS, bool BOOLEAN, binary BYTE_ARRAY, others UTF8.
+// The decimals of unknown precision are DECIMAL(38,s), with s the
+// largest scale of the buffered values. The dots of the names are
+// replaced with underscores.
+func getParquetSchema(columns []Column, buffer [][]interface{}) *schema.SchemaHandler {
 	typeMap := map[string]string{
-		"bool":    "BOOLEAN",
-		"int32":   "INT32",
-		"int64":   "INT64",
-		"float32": "FLOAT",
-		"float64": "DOUBLE",
-		"string":  "UTF8",
-		"uint32":  "UINT_32",
-		"uint64":  "UINT_64",
-		// "int32": "DATE",
-		// "int32": "TIME_MILLIS",
-		// "int64": "TIME_MICROS",
-		// "int64": "TIMESTAMP_MILLIS",
-		// "int64": "TIMESTAMP_MICROS",
-		"slice": "LIST",
-		"map":   "MAP",
-
-		"integer":  "INT64",
-		"decimal":  "DOUBLE",
-		"datetime": "UTF8",
-	}
-	schema := make([]string, len(columns))
-	for i, col := range columns {
+		"bool":        "BOOLEAN",
+		"integer":     "INT64",
+		"date":        "DATE",
+		"datetime":    "TIMESTAMP_MICROS",
+		"timestamptz": "TIMESTAMP_MICROS",
+		"binary":      "BYTE_ARRAY",
+	}
 
-		Type := ""
-		if _, ok := typeMap[col.Type]; ok {
-			Type = typeMap[col.Type]
-		} else if Type != "" {
-			println(F("getParquetCsvSchema - type '%s' not found for '%s'", Type, col.Type))
-			Type = "UTF8"
-		} else {
+	// named Column_1... internally, as the names are paths
+	metadata := make([]string, len(columns))
+	for i, col := range columns {
+		Type, ok := typeMap[col.Type]
+		if !ok {
 			Type = "UTF8"
 		}
+		metadata[i] = F("name=Column_%d, type=%s", i+1, Type)
+
+		if floatColumn(col, i, buffer) {
+			metadata[i] = F("name=Column_%d, type=DOUBLE", i+1)
+		} else if col.Type == "decimal" {
+			precision, scale := decimalSize(col, i, buffer)
+			baseType := "FIXED_LEN_BYTE_ARRAY"
+			if precision <= 9 {
+				baseType = "INT32"
+			} else if precision <= 18 {
+				baseType = "INT64"
+			}
+			metadata[i] = F(
+				"name=Column_%d, type=DECIMAL, basetype=%s, precision=%d, scale=%d, length=%d",
+				i+1, baseType, precision, scale, decimalLength(precision),
+			)
+		}
+	}
+
+	sh := schema.NewSchemaHandlerFromMetadata(metadata)
+	for i, col := range columns {
+		info, element := sh.Infos[i+1], sh.SchemaElements[i+1]
+		info.ExName = strings.Replace(col.Name, ".", "_", -1) // the paths are dot separated
+		if col.nullableKnown && !col.Nullable {
+			element.RepetitionType = parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_REQUIRED)
+		}
+
+		logical := parquet.NewLogicalType()
+		if !element.IsSetConvertedType() {
+			continue
+		}
+		switch element.GetConvertedType() {
+		case parquet.ConvertedType_UTF8:
+			logical.STRING = parquet.NewStringType()
+		case parquet.ConvertedType_DATE:
+			logical.DATE = parquet.NewDateType()
+		case parquet.ConvertedType_DECIMAL:
+			logical.DECIMAL = &parquet.DecimalType{Precision: element.GetPrecision(), Scale: element.GetScale()}
+		case parquet.ConvertedType_TIMESTAMP_MICROS:
+			logical.TIMESTAMP = &parquet.TimestampType{
+				IsAdjustedToUTC: col.Type == "timestamptz",
+				Unit:            &parquet.TimeUnit{MICROS: parquet.NewMicroSeconds()},
+			}
+		default:
+			continue
+		}
+		element.LogicalType = logical
+	}
+	sh.CreateInExMap()
+	return sh
+}
+
+// parquetValue converts a value to the physical type of its parquet
+// element, nil for null
+func parquetValue(val interface{}, col Column, element *parquet.SchemaElement) (interface{}, error) {
+	if v, ok := val.(string); ok && col.Type != "" && col.Type != "string" && col.Type != "text" {
+		val = castVal(v, col.Type) // not cast upstream
+	}
+	if val == nil {
+		if element.GetRepetitionType() == parquet.FieldRepetitionType_REQUIRED {
+			return nil, errors.New("null value in a not nullable column")
+		}
+		return nil, nil
+	}
+
+	switch convertedType := element.ConvertedType; {
+	case convertedType == nil:
+	case *convertedType == parquet.ConvertedType_DECIMAL:
+		d, ok := toDecimal(val)
+		if !ok {
+			return nil, errors.New(F("value %v is not a decimal", val))
+		}
+		unscaled, err := d.unscaledFit(int(element.GetPrecision()), int(element.GetScale()))
+		if err != nil {
+			return nil, err
+		}
+		switch element.GetType() {
+		case parquet.Type_INT32:
+			return int32(unscaled.Int64()), nil
+		case parquet.Type_INT64:
+			return unscaled.Int64(), nil
+		}
+		return types.StrIntToBinary(unscaled.String(), "BigEndian", int(element.GetTypeLength()), true), nil
+	case *convertedType == parquet.ConvertedType_DATE:
+		t, ok := val.(time.Time)
+		if !ok {
+			return nil, errors.New(F("value %v is not a date", val))
+		}
+		return int32(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400), nil
+	case *convertedType == parquet.ConvertedType_TIMESTAMP_MICROS:
+		t, ok := val.(time.Time)
+		if !ok {
+			return nil, errors.New(F("value %v is not a timestamp", val))
+		}
+		if !element.GetLogicalType().GetTIMESTAMP().GetIsAdjustedToUTC() {
+			// the wall clock, as in UTC
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		}
+		return t.Unix()*1e6 + int64(t.Nanosecond()/1e3), nil
+	case *convertedType == parquet.ConvertedType_UTF8:
+		switch v := val.(type) {
+		case []byte:
+			return string(v), nil
+		case time.Time:
+			return formatTime(v, col.Type), nil
+		}
+		return cast.ToString(val), nil
+	}
 
-		colSchema := make([]string, 2)
-		colSchema[0] = "name=" + col.Name
-		colSchema[1] = "type=" + Type
-		schema[i] = strings.Join(colSchema, ", ")
+	switch element.GetType() {
+	case parquet.Type_INT64:
+		return cast.ToInt64E(val)
+	case parquet.Type_BOOLEAN:
+		return cast.ToBoolE(val)
+	case parquet.Type_DOUBLE:
+		if d, ok := val.(Decimal); ok {
+			return d.Float64(), nil
+		}
+		return cast.ToFloat64E(val)
+	case parquet.Type_BYTE_ARRAY:
+		if b, ok := val.([]byte); ok {
+			return string(b), nil
+		}
+		return cast.ToString(val), nil
 	}
-	return schema
+	return val, nil
 }
 
-// WriteStream to Parquet file from datastream
+// marshalParquetRows returns the tables of the columns of rows, as
+// marshal.MarshalCSV but with the REQUIRED columns (without nulls)
+func marshalParquetRows(rows []interface{}, bgn int, end int, sh *schema.SchemaHandler) (*map[string]*layout.Table, error) {
+	tables := make(map[string]*layout.Table)
+	for i := 1; i < len(sh.SchemaElements); i++ {
+		element := sh.SchemaElements[i]
+		pathStr := sh.GetRootInName() + "." + sh.Infos[i].InName
+
+		table := layout.NewEmptyTable()
+		table.Path = common.StrToPath(pathStr)
+		table.RepetitionType = element.GetRepetitionType()
+		table.Type = element.GetType()
+		table.Info = sh.Infos[i]
+		if table.RepetitionType == parquet.FieldRepetitionType_OPTIONAL {
+			table.MaxDefinitionLevel = 1
+		}
+
+		for j := bgn; j < end; j++ {
+			val := rows[j].([]interface{})[i-1]
+			table.Values = append(table.Values, val)
+			table.RepetitionLevels = append(table.RepetitionLevels, 0)
+			if val == nil {
+				table.DefinitionLevels = append(table.DefinitionLevels, 0)
+			} else {
+				table.DefinitionLevels = append(table.DefinitionLevels, table.MaxDefinitionLevel)
+			}
+		}
+		tables[pathStr] = table
+	}
+	return &tables, nil
+}
+
+// WriteStream to Parquet file from datastream, with p.Options
 func (p *Parquet) WriteStream(ds Datastream) error {
+	if err := p.Options.Validate(); err != nil {
+		ds.Cancel()
+		return err
+	}
+
+	ds, err := sampleDecimals(&ds)
+	if err != nil {
+		return err
+	}
 
 	if p.File == nil {
 		file, err := os.Create(p.Path)
 		if err != nil {
+			ds.Cancel()
 			return err
 		}
 		p.File = file
@@ -79,85 +268,410 @@ func (p *Parquet) WriteStream(ds Datastream) error {
 
 	defer p.File.Close()
 
-	schema := getParquetCsvSchema(ds.Columns)
-
-	pw, err := writer.NewCSVWriter(schema, p.PFile, 4)
+	pw, err := writer.NewParquetWriter(p.PFile, nil, 4)
 	if err != nil {
+		ds.Cancel()
 		return err
 	}
-	// defer pw.Flush(true)
+	pw.SchemaHandler = getParquetSchema(ds.Columns, ds.Buffer)
+	pw.Footer.Schema = append(pw.Footer.Schema, pw.SchemaHandler.SchemaElements...)
+	pw.MarshalFunc = marshalParquetRows
+	pw.CompressionType = parquetCodecs[strings.ToLower(p.Options.Codec)]
+	if p.Options.RowGroupSize > 0 {
+		pw.RowGroupSize = p.Options.RowGroupSize
+	}
+	if p.Options.PageSize > 0 {
+		pw.PageSize = p.Options.PageSize
+	}
 
-	for row := range ds.Rows {
+	elements := pw.SchemaHandler.SchemaElements[1:]
+	for row0 := range ds.Rows {
+		row := make([]interface{}, len(elements))
+		for i := range row {
+			if i >= len(row0) {
+				break
+			}
+			row[i], err = parquetValue(row0[i], ds.Columns[i], elements[i])
+			if err != nil {
+				ds.Cancel()
+				return Error(err, "error write row to parquet file, column "+ds.Columns[i].Name)
+			}
+		}
 		err := pw.Write(row)
 		if err != nil {
+			ds.Cancel()
 			return Error(err, "error write row to parquet file")
 		}
 	}
 
+	if err := ds.Err(); err != nil {
+		return Error(err, "Upstream stream failed, parquet file is incomplete")
+	}
+
 	err = pw.WriteStop()
 
 	return err
 }
 
-// func NewFileReader(file io.Reader) (source.ParquetFile, error) {
-// 	return &Parquet{}, nil
-// }
+// parquetColumn is a column read from a Parquet file
+type parquetColumn struct {
+	Column
+	path         string // internal path of the leaf, in the schema handler
+	element      *parquet.SchemaElement
+	maxDef       int32
+	repeatedDef  int32 // definition level of the repeated field, for lists
+	isList       bool
+	elementTypes string // general type of the list elements
+}
 
-// ReadStream returns the read Parquet stream into a Datastream
-// https://github.com/xitongsys/parquet-go/blob/master/example/read_partial.go
-func (p *Parquet) ReadStream() (Datastream, error) {
-	var ds Datastream
+// ReadStream returns the read Parquet stream into a Datastream. The rows
+// are read a row group at a time, with the columns of p.Select (all if
+// empty). The columns are typed from the schema and its logical types.
+// The lists (of one level) are read as JSON arrays.
+func (p *Parquet) ReadStream() (ds Datastream, err error) {
+	path := p.Path
+	if path == "" && p.File != nil {
+		path = p.File.Name()
+	}
 
-	if p.File == nil {
-		file, err := os.Open(p.Path)
-		if err != nil {
-			return ds, err
-		}
-		p.File = file
+	pFile, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return ds, Error(err, "Could not open "+path)
+	}
+
+	pr, err := reader.NewParquetColumnReader(pFile, 4)
+	if err != nil {
+		pFile.Close()
+		return ds, Error(err, "Could not read parquet file "+path)
+	}
+
+	pColumns, err := getParquetColumns(pr.SchemaHandler, p.Select)
+	if err != nil {
+		pr.ReadStop()
+		pFile.Close()
+		return ds, err
 	}
 
-	// reader.NewParquetReader(p.File, interface{}, 4)
-	// r := csv.NewReader(c.File)
-	// row0, err := r.Read()
-	// if err != nil {
-	// 	return ds, err
-	// } else if err == io.EOF {
-	// 	return ds, nil
-	// }
-
-	// ds = Datastream{
-	// 	Rows:    make(chan []interface{}),
-	// 	Columns: c.Columns,
-	// }
-
-	// if ds.Columns == nil {
-	// 	ds.setFields(row0)
-	// }
-
-	// go func() {
-	// 	defer c.File.Close()
-
-	// 	count := 1
-	// 	for {
-	// 		row0, err := r.Read()
-	// 		if err == io.EOF {
-	// 			break
-	// 		} else if err != nil {
-	// 			Check(err, "Error reading file")
-	// 			break
-	// 		}
-
-	// 		count++
-	// 		row := make([]interface{}, len(row0))
-	// 		for i, val := range row0 {
-	// 			row[i] = castVal(val, ds.Columns[i].Type)
-	// 		}
-	// 		ds.Rows <- row
-
-	// 	}
-	// 	// Ensure that at the end of the loop we close the channel!
-	// 	close(ds.Rows)
-	// }()
+	columns := make([]Column, len(pColumns))
+	for i, pCol := range pColumns {
+		columns[i] = pCol.Column
+	}
+
+	ds = NewDatastream(columns)
+	go func() {
+		defer pFile.Close()
+		defer pr.ReadStop()
+		defer ds.Close()
+
+		for _, rowGroup := range pr.Footer.GetRowGroups() {
+			numRows := int(rowGroup.GetNumRows())
+			if numRows == 0 {
+				continue
+			}
+
+			rows := make([][]interface{}, numRows)
+			for i := range rows {
+				rows[i] = make([]interface{}, len(pColumns))
+			}
+
+			for j, pCol := range pColumns {
+				values, rls, dls, err := pr.ReadColumnByPath(pCol.path, numRows)
+				if err != nil {
+					ds.SetError(Error(err, "Could not read parquet column "+pCol.Name))
+					return
+				}
+				if err = pCol.setValues(rows, j, values, rls, dls); err != nil {
+					ds.SetError(Error(err, "Could not read parquet column "+pCol.Name))
+					return
+				}
+			}
+
+			for _, row := range rows {
+				if !ds.push(row) {
+					return
+				}
+			}
+		}
+	}()
 
 	return ds, nil
 }
+
+// getParquetColumns returns the columns of the leaves of the schema,
+// named with their path, or of the selected ones in order
+func getParquetColumns(sh *schema.SchemaHandler, selected []string) (columns []parquetColumn, err error) {
+	elementAt := func(path []string) *parquet.SchemaElement {
+		return sh.SchemaElements[sh.MapIndex[common.PathToStr(path)]]
+	}
+
+	for _, pathStr := range sh.ValueColumns {
+		path := common.StrToPath(pathStr)
+		element := elementAt(path)
+		col := parquetColumn{path: pathStr, element: element}
+
+		// the names of the path, without the root and the levels of the lists
+		names := []string{}
+		repetitions, skipChild := 0, false
+		for i := 2; i <= len(path); i++ {
+			parent, node := elementAt(path[:i-1]), elementAt(path[:i])
+			if node.GetRepetitionType() != parquet.FieldRepetitionType_REQUIRED {
+				col.maxDef++
+			}
+			if node.GetRepetitionType() == parquet.FieldRepetitionType_REPEATED {
+				repetitions++
+				col.repeatedDef = col.maxDef
+			}
+
+			if isParquetListOrMap(parent) {
+				skipChild = node.GetNumChildren() == 1 && parent.GetConvertedType() == parquet.ConvertedType_LIST // e.g. list.element
+			} else if skipChild {
+				skipChild = false
+			} else {
+				names = append(names, sh.Infos[sh.MapIndex[common.PathToStr(path[:i])]].ExName)
+			}
+		}
+
+		col.Name = strings.Join(names, ".")
+		col.Nullable = col.maxDef > 0
+		col.nullableKnown = true
+		col.Type = parquetGeneralType(element)
+		if col.Type == "decimal" {
+			col.Precision, col.Scale = int(element.GetPrecision()), int(element.GetScale())
+			col.floating = element.GetType() == parquet.Type_FLOAT || element.GetType() == parquet.Type_DOUBLE
+		}
+		if repetitions > 0 {
+			col.isList, col.elementTypes, col.Type = true, col.Type, "array"
+			col.Precision, col.Scale = 0, 0
+		}
+		if repetitions > 1 {
+			col.Type = "unsupported"
+		}
+		columns = append(columns, col)
+	}
+
+	if len(selected) == 0 {
+		for _, col := range columns {
+			if col.Type == "unsupported" {
+				return nil, errors.New(F("Nested lists are not supported (column %s), select the other columns", col.Name))
+			}
+		}
+		return columns, nil
+	}
+
+	// projected, in the order selected
+	projected := make([]parquetColumn, len(selected))
+	for i, name := range selected {
+		found := false
+		for _, col := range columns {
+			if strings.EqualFold(col.Name, name) {
+				projected[i], found = col, true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New(F("Column '%s' not found in parquet file", name))
+		} else if projected[i].Type == "unsupported" {
+			return nil, errors.New(F("Nested lists are not supported (column %s)", name))
+		}
+		projected[i].Position = int64(i + 1)
+	}
+	return projected, nil
+}
+
+// isParquetListOrMap returns true for a LIST or MAP group, of a repeated group
+func isParquetListOrMap(element *parquet.SchemaElement) bool {
+	if !element.IsSetConvertedType() {
+		return false
+	}
+	switch element.GetConvertedType() {
+	case parquet.ConvertedType_LIST, parquet.ConvertedType_MAP, parquet.ConvertedType_MAP_KEY_VALUE:
+		return true
+	}
+	return false
+}
+
+// parquetGeneralType returns the general type of a leaf, from its
+// logical or converted type, or physical type
+func parquetGeneralType(element *parquet.SchemaElement) string {
+	if logical := element.GetLogicalType(); logical != nil {
+		switch {
+		case logical.IsSetTIMESTAMP():
+			if logical.GetTIMESTAMP().GetIsAdjustedToUTC() {
+				return "timestamptz"
+			}
+			return "datetime"
+		case logical.IsSetDATE():
+			return "date"
+		case logical.IsSetDECIMAL():
+			return "decimal"
+		case logical.IsSetJSON():
+			return "json"
+		case logical.IsSetSTRING(), logical.IsSetENUM(), logical.IsSetUUID(), logical.IsSetTIME():
+			return "string"
+		}
+	}
+
+	if element.IsSetConvertedType() {
+		switch element.GetConvertedType() {
+		case parquet.ConvertedType_TIMESTAMP_MILLIS, parquet.ConvertedType_TIMESTAMP_MICROS:
+			return "datetime"
+		case parquet.ConvertedType_DATE:
+			return "date"
+		case parquet.ConvertedType_DECIMAL:
+			return "decimal"
+		case parquet.ConvertedType_JSON:
+			return "json"
+		case parquet.ConvertedType_UTF8, parquet.ConvertedType_ENUM,
+			parquet.ConvertedType_TIME_MILLIS, parquet.ConvertedType_TIME_MICROS:
+			return "string"
+		}
+	}
+
+	switch element.GetType() {
+	case parquet.Type_BOOLEAN:
+		return "bool"
+	case parquet.Type_INT32, parquet.Type_INT64:
+		return "integer"
+	case parquet.Type_INT96:
+		return "datetime"
+	case parquet.Type_FLOAT, parquet.Type_DOUBLE:
+		return "decimal"
+	}
+	return "binary"
+}
+
+// setValues sets the values of the column j in the rows of a row group.
+// The values of a list are grouped by row, with their repetition levels.
+func (col *parquetColumn) setValues(rows [][]interface{}, j int, values []interface{}, rls, dls []int32) error {
+	if !col.isList {
+		if len(values) != len(rows) {
+			return errors.New(F("read %d values for %d rows", len(values), len(rows)))
+		}
+		for i, val := range values {
+			if dls[i] < col.maxDef {
+				val = nil
+			}
+			rows[i][j] = col.value(val, col.Type)
+		}
+		return nil
+	}
+
+	i := -1
+	var list []interface{}
+	setList := func() {
+		if i >= 0 && i < len(rows) && list != nil {
+			rows[i][j] = col.listJSON(list)
+		}
+	}
+	for k, val := range values {
+		if rls[k] == 0 {
+			setList()
+			i++
+			list = nil
+		}
+		if dls[k] < col.repeatedDef {
+			continue // null or empty list
+		}
+		if dls[k] < col.maxDef {
+			val = nil
+		}
+		list = append(list, col.value(val, col.elementTypes))
+	}
+	setList()
+
+	if i+1 != len(rows) {
+		return errors.New(F("read %d lists for %d rows", i+1, len(rows)))
+	}
+	return nil
+}
+
+// listJSON returns the JSON array of the values of a list
+func (col *parquetColumn) listJSON(list []interface{}) string {
+	items := make([]string, len(list))
+	for i, val := range list {
+		items[i] = string(jsonValue(val, Column{Type: col.elementTypes}))
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+// value converts a physical value to its general type
+func (col *parquetColumn) value(val interface{}, generalType string) interface{} {
+	if val == nil {
+		return nil
+	}
+
+	element := col.element
+	switch generalType {
+	case "decimal":
+		var unscaled *big.Int
+		switch v := val.(type) {
+		case float32:
+			return processVal(v)
+		case float64:
+			return v
+		case int32:
+			unscaled = big.NewInt(int64(v))
+		case int64:
+			unscaled = big.NewInt(v)
+		case string:
+			unscaled = unscaledFromBytes([]byte(v))
+		default:
+			return val
+		}
+		return decimalFromUnscaled(unscaled, int(element.GetScale()))
+	case "date":
+		if v, ok := val.(int32); ok {
+			return time.Unix(int64(v)*86400, 0).UTC()
+		}
+	case "datetime", "timestamptz":
+		switch v := val.(type) {
+		case int64:
+			unit := time.Microsecond
+			if logical := element.GetLogicalType(); logical != nil && logical.IsSetTIMESTAMP() {
+				if u := logical.GetTIMESTAMP().GetUnit(); u.IsSetMILLIS() {
+					unit = time.Millisecond
+				} else if u.IsSetNANOS() {
+					unit = time.Nanosecond
+				}
+			} else if element.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MILLIS {
+				unit = time.Millisecond
+			}
+			// split, as nanoseconds overflow after 2262
+			perSecond := int64(time.Second / unit)
+			return time.Unix(v/perSecond, (v%perSecond)*int64(unit)).UTC()
+		case string:
+			// INT96: nanoseconds of the day, then julian day (little-endian)
+			if len(v) == 12 {
+				nanos := int64(binary.LittleEndian.Uint64([]byte(v[:8])))
+				days := int64(binary.LittleEndian.Uint32([]byte(v[8:])))
+				return time.Unix((days-2440588)*86400, nanos).UTC()
+			}
+		}
+	case "string":
+		switch v := val.(type) {
+		case int32: // TIME_MILLIS
+			return time.Unix(0, int64(v)*int64(time.Millisecond)).UTC().Format("15:04:05.999")
+		case int64: // TIME_MICROS / NANOS
+			unit := time.Microsecond
+			if logical := element.GetLogicalType(); logical != nil && logical.IsSetTIME() && logical.GetTIME().GetUnit().IsSetNANOS() {
+				unit = time.Nanosecond
+			}
+			return time.Unix(0, v*int64(unit)).UTC().Format("15:04:05.999999999")
+		case string:
+			if logical := element.GetLogicalType(); logical != nil && logical.IsSetUUID() && len(v) == 16 {
+				h := hex.EncodeToString([]byte(v))
+				return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+			}
+			return v
+		}
+	case "binary":
+		if v, ok := val.(string); ok {
+			return []byte(v)
+		}
+	case "integer":
+		return types.ParquetTypeToGoType(val, element.Type, element.ConvertedType)
+	case "bool", "json":
+		return val
+	}
+	return val
+}
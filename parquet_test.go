@@ -3,8 +3,14 @@ package gxutil
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/types"
+	"github.com/xitongsys/parquet-go/writer"
 )
 
 func TestParquet(t *testing.T) {
@@ -27,4 +33,223 @@ func TestParquet(t *testing.T) {
 
 	err = os.Remove(pqPath)
 
-}
\ No newline at end of file
+}
+
+func TestParquetReadStream(t *testing.T) {
+	type pqRow struct {
+		ID      int64    `parquet:"name=id, type=INT64"`
+		Name    *string  `parquet:"name=name, type=UTF8, repetitiontype=OPTIONAL"`
+		Amount  string   `parquet:"name=amount, type=DECIMAL, scale=2, precision=20, basetype=BYTE_ARRAY"`
+		Price   int32    `parquet:"name=price, type=DECIMAL, scale=3, precision=9, basetype=INT32"`
+		Day     int32    `parquet:"name=day, type=DATE"`
+		Created int64    `parquet:"name=created, type=TIMESTAMP_MICROS"`
+		Ratio   float64  `parquet:"name=ratio, type=DOUBLE"`
+		Active  bool     `parquet:"name=active, type=BOOLEAN"`
+		Tags    []string `parquet:"name=tags, type=LIST, valuetype=UTF8"`
+		Payload string   `parquet:"name=payload, type=BYTE_ARRAY"`
+	}
+
+	pqPath := "test/read.parquet"
+	defer os.Remove(pqPath)
+
+	fw, err := local.NewLocalFileWriter(pqPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	pw, err := writer.NewParquetWriter(fw, new(pqRow), 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	pw.RowGroupSize = 1 // a row group per row
+
+	name := "a"
+	created := time.Date(2020, 3, 25, 10, 30, 15, 123456000, time.UTC)
+	rows := []pqRow{
+		{1, &name, types.StrIntToBinary("-12345678901234567890", "BigEndian", 0, true), 1500, 18346, created.UnixNano() / 1000, 0.5, true, []string{"x", "y"}, "\x01\x02"},
+		{2, nil, types.StrIntToBinary("5", "BigEndian", 0, true), -1, 0, 0, 1, false, nil, ""},
+	}
+	for _, row := range rows {
+		assert.NoError(t, pw.Write(row))
+	}
+	assert.NoError(t, pw.WriteStop())
+	fw.Close()
+
+	ds, err := (&Parquet{Path: pqPath}).ReadStream()
+	if !assert.NoError(t, err) {
+		return
+	}
+	colTypes := map[string]string{}
+	for _, col := range ds.Columns {
+		colTypes[col.Name] = col.Type
+	}
+	assert.Equal(t, map[string]string{
+		"id": "integer", "name": "string", "amount": "decimal", "price": "decimal", "day": "date",
+		"created": "datetime", "ratio": "decimal", "active": "bool", "tags": "array", "payload": "binary",
+	}, colTypes)
+	assert.Equal(t, 20, ds.Columns[2].Precision)
+	assert.True(t, ds.Columns[1].Nullable)
+
+	data := ds.Collect()
+	assert.NoError(t, ds.Err())
+	if assert.Len(t, data.Rows, 2) {
+		assert.Equal(t, []interface{}{
+			int64(1), "a", Decimal("-123456789012345678.90"), Decimal("1.500"), time.Date(2020, 3, 25, 0, 0, 0, 0, time.UTC),
+			created, 0.5, true, `["x","y"]`, []byte{1, 2},
+		}, data.Rows[0])
+		assert.Equal(t, []interface{}{
+			int64(2), nil, Decimal("0.05"), Decimal("-0.001"), time.Unix(0, 0).UTC(),
+			time.Unix(0, 0).UTC(), 1.0, false, nil, []byte{},
+		}, data.Rows[1])
+	}
+
+	// projected
+	ds, err = (&Parquet{Path: pqPath, Select: []string{"tags", "ID"}}).ReadStream()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"tags", "id"}, ds.GetFields())
+		assert.Equal(t, [][]interface{}{{`["x","y"]`, int64(1)}, {nil, int64(2)}}, ds.Collect().Rows)
+	}
+
+	_, err = (&Parquet{Path: pqPath, Select: []string{"missing"}}).ReadStream()
+	assert.Error(t, err)
+}
+
+func TestParquetWriteStream(t *testing.T) {
+	created := time.Date(2020, 3, 25, 10, 30, 15, 123456000, time.UTC)
+	data := Dataset{
+		Columns: []Column{
+			{Name: "id", Type: "integer", nullableKnown: true},
+			{Name: "amount", Type: "decimal", Precision: 20, Scale: 2, Nullable: true, nullableKnown: true},
+			{Name: "price", Type: "decimal", Precision: 9, Scale: 3},
+			{Name: "ratio", Type: "decimal"},
+			{Name: "day", Type: "date"},
+			{Name: "created", Type: "datetime"},
+			{Name: "created_tz", Type: "timestamptz"},
+			{Name: "name, with.dots", Type: "string"},
+			{Name: "active", Type: "bool"},
+			{Name: "payload", Type: "binary"},
+		},
+		Rows: [][]interface{}{
+			{int64(1), Decimal("-123456789012345678.90"), Decimal("1.5"), 0.25, time.Date(2020, 3, 25, 0, 0, 0, 0, time.UTC), created, created.In(time.FixedZone("", 3600)), "a", true, []byte{1, 2}},
+			{int64(2), nil, "-0.001", nil, nil, nil, nil, nil, nil, nil},
+		},
+	}
+
+	pqPath := "test/write.parquet"
+	defer os.Remove(pqPath)
+
+	for _, codec := range []string{"", "gzip", "zstd", "none"} {
+		pq := Parquet{Path: pqPath, Options: ParquetOptions{Codec: codec}}
+		if !assert.NoError(t, pq.WriteStream(data.Stream()), codec) {
+			continue
+		}
+
+		// the schema and options
+		pFile, err := local.NewLocalFileReader(pqPath)
+		if !assert.NoError(t, err) {
+			return
+		}
+		pr, err := reader.NewParquetColumnReader(pFile, 1)
+		if !assert.NoError(t, err) {
+			return
+		}
+		elements := pr.Footer.Schema
+		assert.Equal(t, "name, with_dots", pr.SchemaHandler.Infos[8].ExName)
+		assert.Equal(t, parquet.FieldRepetitionType_REQUIRED, elements[1].GetRepetitionType())
+		assert.Equal(t, parquet.FieldRepetitionType_OPTIONAL, elements[2].GetRepetitionType())
+		assert.Equal(t, parquet.FieldRepetitionType_OPTIONAL, elements[3].GetRepetitionType())
+		assert.Equal(t, parquet.Type_FIXED_LEN_BYTE_ARRAY, elements[2].GetType())
+		assert.Equal(t, parquet.Type_INT32, elements[3].GetType())
+		assert.Equal(t, parquet.Type_DOUBLE, elements[4].GetType())
+		assert.Equal(t, parquet.ConvertedType_DATE, elements[5].GetConvertedType())
+		assert.Equal(t, parquet.ConvertedType_TIMESTAMP_MICROS, elements[6].GetConvertedType())
+		assert.False(t, elements[6].GetLogicalType().GetTIMESTAMP().GetIsAdjustedToUTC())
+		assert.True(t, elements[7].GetLogicalType().GetTIMESTAMP().GetIsAdjustedToUTC())
+		assert.Equal(t, parquetCodecs[codec], pr.Footer.RowGroups[0].Columns[0].MetaData.GetCodec())
+		pr.ReadStop()
+		pFile.Close()
+
+		// read back
+		ds, err := (&Parquet{Path: pqPath}).ReadStream()
+		if !assert.NoError(t, err) {
+			return
+		}
+		colTypes := []string{}
+		for _, col := range ds.Columns {
+			colTypes = append(colTypes, col.Type)
+		}
+		assert.Equal(t, []string{"integer", "decimal", "decimal", "decimal", "date", "datetime", "timestamptz", "string", "bool", "binary"}, colTypes)
+		assert.Equal(t, [][]interface{}{
+			{int64(1), Decimal("-123456789012345678.90"), Decimal("1.500"), 0.25, time.Date(2020, 3, 25, 0, 0, 0, 0, time.UTC), created, created, "a", true, []byte{1, 2}},
+			{int64(2), nil, Decimal("-0.001"), nil, nil, nil, nil, nil, nil, nil},
+		}, ds.Collect().Rows)
+		assert.NoError(t, ds.Err())
+	}
+
+	// a row group per flush of the pages, with the smallest sizes
+	ids := Dataset{Columns: []Column{{Name: "id", Type: "integer"}}}
+	for i := 0; i < 1000; i++ {
+		ids.Rows = append(ids.Rows, []interface{}{int64(i)})
+	}
+	for _, options := range []ParquetOptions{{}, {RowGroupSize: 1, PageSize: 64}} {
+		assert.NoError(t, (&Parquet{Path: pqPath, Options: options}).WriteStream(ids.Stream()))
+		pFile, _ := local.NewLocalFileReader(pqPath)
+		pr, err := reader.NewParquetColumnReader(pFile, 1)
+		if assert.NoError(t, err) {
+			assert.Equal(t, options.RowGroupSize == 0, len(pr.Footer.RowGroups) == 1)
+			pr.ReadStop()
+		}
+		pFile.Close()
+
+		ds, err := (&Parquet{Path: pqPath}).ReadStream()
+		if assert.NoError(t, err) {
+			assert.Equal(t, ids.Rows, ds.Collect().Rows)
+		}
+	}
+
+	// far from the epoch, past the nanoseconds of an int64
+	times := Dataset{
+		Columns: []Column{{Name: "created", Type: "datetime"}, {Name: "created_tz", Type: "timestamptz"}},
+		Rows: [][]interface{}{
+			{time.Date(9999, 12, 31, 23, 59, 59, 999999000, time.UTC), time.Date(2262, 4, 12, 0, 0, 0, 1000, time.UTC)},
+			{time.Date(1969, 12, 31, 23, 59, 59, 500000000, time.UTC), time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	if assert.NoError(t, (&Parquet{Path: pqPath}).WriteStream(times.Stream())) {
+		ds, err := (&Parquet{Path: pqPath}).ReadStream()
+		if assert.NoError(t, err) {
+			assert.Equal(t, times.Rows, ds.Collect().Rows)
+		}
+	}
+
+	// not nullable, or not fitting
+	data.Rows = [][]interface{}{{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}}
+	assert.Error(t, (&Parquet{Path: pqPath}).WriteStream(data.Stream()))
+	data.Rows = [][]interface{}{{int64(1), nil, Decimal("1234567"), nil, nil, nil, nil, nil, nil, nil}}
+	assert.Error(t, (&Parquet{Path: pqPath}).WriteStream(data.Stream()))
+	data.Rows = [][]interface{}{{int64(1), nil, Decimal("1.0005"), nil, nil, nil, nil, nil, nil, nil}}
+	assert.Error(t, (&Parquet{Path: pqPath}).WriteStream(data.Stream()))
+
+	// floats of unknown precision, as doubles
+	floats := Dataset{
+		Columns: []Column{{Name: "f", Type: "decimal"}, {Name: "d", Type: "decimal"}},
+		Rows:    [][]interface{}{{0.5, Decimal("0.5")}, {1.0 / 3.0, "0.25"}, {nil, nil}},
+	}
+	if assert.NoError(t, (&Parquet{Path: pqPath}).WriteStream(floats.Stream())) {
+		ds, err := (&Parquet{Path: pqPath}).ReadStream()
+		if assert.NoError(t, err) {
+			assert.Equal(t, [][]interface{}{{0.5, Decimal("0.50")}, {1.0 / 3.0, Decimal("0.25")}, {nil, nil}}, ds.Collect().Rows)
+			assert.True(t, ds.Columns[0].floating)
+			assert.False(t, ds.Columns[1].floating)
+		}
+	}
+	assert.True(t, floatColumn(Column{Type: "decimal", floating: true}, 0, nil))
+	assert.False(t, floatColumn(Column{Type: "decimal"}, 0, [][]interface{}{{0.5}, {Decimal("0.5")}}))
+	assert.False(t, floatColumn(Column{Type: "decimal", Precision: 10}, 0, [][]interface{}{{0.5}}))
+
+	// the scale of the buffered values
+	precision, scale := decimalSize(Column{Type: "decimal"}, 0, [][]interface{}{{0.25}, {Decimal("1.5")}, {nil}})
+	assert.Equal(t, []int{38, 2}, []int{precision, scale})
+
+	assert.Error(t, ParquetOptions{Codec: "lzo"}.Validate())
+	assert.Error(t, ParquetOptions{PageSize: -1}.Validate())
+}
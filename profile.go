@@ -0,0 +1,211 @@
+package gxutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Profile is a connection profile file, see `templates/profile.def.yaml`
+type Profile struct {
+	Path        string
+	Databases   map[string]ProfileDB `yaml:"databases"`
+	Environment map[string]string    `yaml:"environment"`
+	Variables   map[string]string    `yaml:"variables"`
+}
+
+// ProfileDB is a named database entry of a profile
+type ProfileDB struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Database string `yaml:"database"`
+	Service  string `yaml:"service"`
+	Sid      string `yaml:"sid"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	SslMode  string `yaml:"sslmode"`
+	URL      string `yaml:"url"`
+}
+
+// DefaultProfilePath returns the default profile path `~/.sling/profile.yaml`
+func DefaultProfilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".sling", "profile.yaml")
+	}
+	return filepath.Join(home, ".sling", "profile.yaml")
+}
+
+// LoadProfile reads the profile yaml file at path.
+// If path is empty, the default profile path is used
+func LoadProfile(path string) (profile Profile, err error) {
+	if path == "" {
+		path = DefaultProfilePath()
+	}
+
+	profileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return profile, Error(err, "Could not read profile "+path)
+	}
+
+	err = yaml.Unmarshal(profileBytes, &profile)
+	if err != nil {
+		return profile, Error(err, "yaml.Unmarshal for profile "+path)
+	}
+	profile.Path = path
+
+	return profile, nil
+}
+
+// GetDB returns the database entry for name (case insensitive),
+// named after its key if it has no `name`
+func (p *Profile) GetDB(name string) (db ProfileDB, err error) {
+	if db, ok := p.Databases[name]; ok {
+		if db.Name == "" {
+			db.Name = name
+		}
+		return db, nil
+	}
+
+	for key, db := range p.Databases {
+		if strings.EqualFold(key, name) {
+			if db.Name == "" {
+				db.Name = key
+			}
+			return db, nil
+		}
+	}
+
+	return db, errors.New(F("Database '%s' not found in profile %s", name, p.Path))
+}
+
+// GetURL returns the driver URL of the named database
+func (p *Profile) GetURL(name string) (string, error) {
+	db, err := p.GetDB(name)
+	if err != nil {
+		return "", err
+	}
+	return db.GetURL()
+}
+
+// ResolveURL returns nameOrURL if it is already a URL,
+// otherwise the driver URL of the named database
+func (p *Profile) ResolveURL(nameOrURL string) (string, error) {
+	if nameOrURL == "" || strings.Contains(nameOrURL, ":") {
+		return nameOrURL, nil
+	}
+	return p.GetURL(nameOrURL)
+}
+
+// GetConnByName returns the connection of the named database
+func (p *Profile) GetConnByName(name string) (Connection, error) {
+	URL, err := p.GetURL(name)
+	if err != nil {
+		return nil, err
+	}
+	return GetConn(URL), nil
+}
+
+// GetConnByName returns the connection of a database
+// named in the default profile
+func GetConnByName(name string) (Connection, error) {
+	profile, err := LoadProfile("")
+	if err != nil {
+		return nil, err
+	}
+	return profile.GetConnByName(name)
+}
+
+// resolveSecrets resolves the `${ENV_VAR}` references of the values.
+// The user and password can also be a bare `file:/path` reference.
+func (db ProfileDB) resolveSecrets() (ProfileDB, error) {
+	var err error
+	values := []*string{
+		&db.Host, &db.Port, &db.Database, &db.Service,
+		&db.Sid, &db.SslMode, &db.URL,
+	}
+	for _, value := range values {
+		*value, err = ResolveSecrets(*value)
+		if err != nil {
+			return db, err
+		}
+	}
+
+	for _, value := range []*string{&db.User, &db.Password} {
+		*value, err = resolveSecretValue(*value)
+		if err != nil {
+			return db, err
+		}
+	}
+	RegisterSecret(db.Password)
+
+	return db, nil
+}
+
+// GetURL builds the driver URL for the database type.
+// A non-JDBC `url` value is used as is.
+func (db ProfileDB) GetURL() (string, error) {
+	db, err := db.resolveSecrets()
+	if err != nil {
+		return "", Error(err, "Could not resolve secrets for "+db.Name)
+	}
+
+	if db.URL != "" && !strings.HasPrefix(db.URL, "jdbc:") {
+		return db.URL, nil
+	}
+
+	host := db.Host
+	if db.Port != "" {
+		host = host + ":" + db.Port
+	}
+
+	u := url.URL{Host: host}
+	if db.User != "" {
+		u.User = url.UserPassword(db.User, db.Password)
+	}
+
+	query := url.Values{}
+
+	switch strings.ToLower(db.Type) {
+	case "postgres", "postgresql", "redshift":
+		// the registered `redshift` scheme keeps the connection type,
+		// whatever the host is
+		u.Scheme = "postgres"
+		if strings.ToLower(db.Type) == "redshift" {
+			u.Scheme = "redshift"
+		}
+		u.Path = "/" + db.Database
+		if db.SslMode != "" {
+			query.Set("sslmode", db.SslMode)
+		}
+	case "mysql":
+		u.Scheme = "mysql"
+		u.Path = "/" + db.Database
+	case "oracle":
+		u.Scheme = "oracle"
+		u.Path = "/" + db.Service
+		if db.Service == "" {
+			u.Path = "/" + db.Sid
+		}
+	case "sqlserver":
+		u.Scheme = "sqlserver"
+		if db.Database != "" {
+			query.Set("database", db.Database)
+		}
+	case "sqlite", "sqlite3":
+		return "file:" + db.Database, nil
+	default:
+		return "", errors.New(F("Unsupported profile database type '%s' for %s", db.Type, db.Name))
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,144 @@
+package gxutil
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ConnFactory returns a new Connection for the provided URL.
+// The connection is initiated by GetConn after creation.
+type ConnFactory func(URL string) Connection
+
+// ConnDriver holds the metadata of a registered connection type
+type ConnDriver struct {
+	Type         string // the connection type, e.g. `postgres`
+	DriverName   string // the database/sql driver name, e.g. `godror`
+	TemplateFile string // the yaml template, a name in `templates/` or a path on disk
+	BulkImport   bool   // whether bulk import is allowed by default
+	BulkExport   bool   // whether bulk export is allowed by default
+}
+
+type connRegistration struct {
+	factory ConnFactory
+	driver  ConnDriver
+}
+
+var (
+	connRegistryMux sync.RWMutex
+	connSchemes     = map[string]connRegistration{} // keyed by URL scheme
+	connDrivers     = map[string]ConnDriver{}       // keyed by connection type
+)
+
+func init() {
+	// Turn off Bulk export for now
+	// the CopyToStdout function frequently produces error `read |0: file already closed`
+	postgresDriver := ConnDriver{Type: "postgres", DriverName: "postgres", BulkImport: true}
+	postgresFactory := func(URL string) Connection {
+		if isRedshift(URL) {
+			return &RedshiftConn{URL: URL}
+		}
+		return &PostgresConn{URL: URL}
+	}
+	RegisterConnection("postgres", postgresFactory, postgresDriver)
+	RegisterConnection("postgresql", postgresFactory, postgresDriver)
+
+	RegisterConnection(
+		"redshift",
+		func(URL string) Connection { return &RedshiftConn{URL: URL} },
+		ConnDriver{Type: "redshift", DriverName: "postgres", BulkImport: true, BulkExport: true},
+	)
+
+	// Turn off Bulk export for now
+	// the LoadDataOutFile needs special circumstances
+	RegisterConnection(
+		"mysql",
+		func(URL string) Connection { return &MySQLConn{URL: URL} },
+		ConnDriver{Type: "mysql", DriverName: "mysql", BulkImport: true},
+	)
+
+	RegisterConnection(
+		"sqlserver",
+		func(URL string) Connection { return &MsSQLServerConn{URL: URL} },
+		ConnDriver{Type: "sqlserver", DriverName: "mssql"},
+	)
+
+	RegisterConnection(
+		"oracle",
+		func(URL string) Connection { return &OracleConn{URL: URL} },
+		ConnDriver{Type: "oracle", DriverName: "godror"},
+	)
+
+	RegisterConnection(
+		"file",
+		func(URL string) Connection { return &BaseConn{URL: URL, Type: "sqlite3"} },
+		ConnDriver{Type: "sqlite3", DriverName: "sqlite3"},
+	)
+}
+
+// RegisterConnection registers a connection factory for a URL scheme
+// (the part before the `:`), along with the driver metadata of the
+// connection type it creates. Registering an existing scheme overrides it.
+func RegisterConnection(scheme string, factory ConnFactory, driver ConnDriver) {
+	if factory == nil {
+		panic("RegisterConnection: factory is nil for scheme " + scheme)
+	}
+
+	if driver.Type == "" {
+		driver.Type = scheme
+	}
+	if driver.DriverName == "" {
+		driver.DriverName = driver.Type
+	}
+	if driver.TemplateFile == "" {
+		driver.TemplateFile = driver.Type + ".yaml"
+	}
+
+	connRegistryMux.Lock()
+	defer connRegistryMux.Unlock()
+
+	connSchemes[strings.ToLower(scheme)] = connRegistration{factory, driver}
+	connDrivers[driver.Type] = driver
+}
+
+// GetConnDriver returns the registered driver metadata of a connection type
+func GetConnDriver(connType string) (driver ConnDriver, ok bool) {
+	connRegistryMux.RLock()
+	defer connRegistryMux.RUnlock()
+	driver, ok = connDrivers[connType]
+	return
+}
+
+// RegisteredSchemes returns the registered URL schemes
+func RegisteredSchemes() (schemes []string) {
+	connRegistryMux.RLock()
+	defer connRegistryMux.RUnlock()
+	for scheme := range connSchemes {
+		schemes = append(schemes, scheme)
+	}
+	return
+}
+
+// RegisteredTypes returns the sorted connection types of the registered drivers
+func RegisteredTypes() (types []string) {
+	connRegistryMux.RLock()
+	defer connRegistryMux.RUnlock()
+	for connType := range connDrivers {
+		types = append(types, connType)
+	}
+	sort.Strings(types)
+	return
+}
+
+// getConnRegistration returns the registration matching the URL scheme
+func getConnRegistration(URL string) (reg connRegistration, ok bool) {
+	i := strings.Index(URL, ":")
+	if i < 1 {
+		return reg, false
+	}
+
+	connRegistryMux.RLock()
+	defer connRegistryMux.RUnlock()
+	reg, ok = connSchemes[strings.ToLower(URL[:i])]
+	return
+}
@@ -87,7 +87,11 @@ func (s *S3) ReadStream(key string) (*io.PipeReader, error) {
 				Bucket: aws.String(s.Bucket),
 				Key:    aws.String(key),
 			})
-		Check(err, "Error downloading S3 File -> "+key)
+		if err != nil {
+			// the reader fails instead of ending as an empty file
+			pipeW.CloseWithError(Error(err, "Error downloading S3 File -> "+key))
+			return
+		}
 		pipeW.Close()
 	}()
 
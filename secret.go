@@ -0,0 +1,191 @@
+package gxutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const redactedMask = "****"
+
+var (
+	secretsMux sync.RWMutex
+	secrets    = map[string]struct{}{}
+
+	// matches `${ENV_VAR}` and `${file:/path/to/secret}`
+	secretRefRegex = regexp.MustCompile(`\$\{([^}]+)\}`)
+)
+
+// RegisterSecret adds a value to be masked by Redact, in its raw
+// and URL-encoded forms.
+func RegisterSecret(secret string) {
+	if secret == "" {
+		return
+	}
+
+	secretsMux.Lock()
+	defer secretsMux.Unlock()
+	secrets[secret] = struct{}{}
+	secrets[url.PathEscape(secret)] = struct{}{}
+	secrets[url.QueryEscape(secret)] = struct{}{}
+	secrets[url.User(secret).String()] = struct{}{}
+}
+
+// RegisterURLSecrets registers the password of a connection URL as a secret
+func RegisterURLSecrets(URL string) {
+	u, err := url.Parse(URL)
+	if err != nil || u.User == nil {
+		return
+	}
+	if password, ok := u.User.Password(); ok {
+		RegisterSecret(password)
+	}
+}
+
+// Redact masks the registered secrets in text
+func Redact(text string) string {
+	secretsMux.RLock()
+	defer secretsMux.RUnlock()
+
+	if len(secrets) == 0 {
+		return text
+	}
+
+	// longest first, so a secret containing another is fully masked
+	values := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		values = append(values, secret)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	args := make([]string, 0, len(values)*2)
+	for _, secret := range values {
+		args = append(args, secret, redactedMask)
+	}
+	return strings.NewReplacer(args...).Replace(text)
+}
+
+// redactedError masks the registered secrets in the text of an error
+type redactedError struct {
+	err error
+}
+
+func (e redactedError) Error() string {
+	return Redact(e.err.Error())
+}
+
+// redactError returns the error, masking its text if it has secrets
+func redactError(err error) error {
+	if err == nil || Redact(err.Error()) == err.Error() {
+		return err
+	}
+	return redactedError{err}
+}
+
+// ResolveSecrets replaces the `${ENV_VAR}` references in s with the value
+// of the environment variable, and `${file:/path}` references with the
+// trimmed content of the file. Resolved values are registered as secrets.
+// In a URL, the values of the user info, path and query are escaped.
+func ResolveSecrets(s string) (string, error) {
+	refs := secretRefRegex.FindAllStringSubmatchIndex(s, -1)
+	escapes := urlRefEscapes(s, refs)
+
+	resolved := strings.Builder{}
+	last := 0
+	for i, ref := range refs {
+		resolved.WriteString(s[last:ref[0]])
+		last = ref[1]
+
+		value, err := resolveSecretRef(s[ref[2]:ref[3]])
+		if err != nil {
+			return s, err
+		}
+		RegisterSecret(value)
+		resolved.WriteString(escapes[i](value))
+	}
+	resolved.WriteString(s[last:])
+
+	return resolved.String(), nil
+}
+
+// urlRefEscapes returns the escape function of each reference of s,
+// by the part of the URL it is in (none if s is not a URL)
+func urlRefEscapes(s string, refs [][]int) (escapes []func(string) string) {
+	// the references are masked, as their keys can have any character
+	masked := []byte(s)
+	for _, ref := range refs {
+		for i := ref[0]; i < ref[1]; i++ {
+			masked[i] = 'x'
+		}
+	}
+
+	noEscape := func(value string) string { return value }
+	userEscape := func(value string) string { return url.User(value).String() }
+
+	authStart, authEnd, userEnd, queryStart := -1, -1, -1, -1
+	if i := strings.Index(string(masked), "://"); i > -1 {
+		authStart = i + 3
+		authEnd = len(masked)
+		if j := strings.IndexAny(string(masked[authStart:]), "/?#"); j > -1 {
+			authEnd = authStart + j
+		}
+		if j := strings.LastIndex(string(masked[authStart:authEnd]), "@"); j > -1 {
+			userEnd = authStart + j
+		}
+		if j := strings.IndexAny(string(masked[authEnd:]), "?#"); j > -1 && masked[authEnd+j] == '?' {
+			queryStart = authEnd + j
+		}
+	}
+
+	for _, ref := range refs {
+		switch {
+		case authStart == -1:
+			escapes = append(escapes, noEscape)
+		case ref[0] >= authStart && ref[1] <= userEnd:
+			escapes = append(escapes, userEscape)
+		case queryStart > -1 && ref[0] > queryStart:
+			escapes = append(escapes, url.QueryEscape)
+		case ref[0] >= authEnd:
+			escapes = append(escapes, url.PathEscape)
+		default:
+			escapes = append(escapes, noEscape) // the host and port
+		}
+	}
+	return escapes
+}
+
+// resolveSecretValue resolves a whole value, which can also be
+// a bare `file:/path` reference
+func resolveSecretValue(value string) (string, error) {
+	if strings.HasPrefix(value, "file:") {
+		secret, err := resolveSecretRef(value)
+		if err != nil {
+			return value, err
+		}
+		RegisterSecret(secret)
+		return secret, nil
+	}
+	return ResolveSecrets(value)
+}
+
+func resolveSecretRef(key string) (string, error) {
+	if strings.HasPrefix(key, "file:") {
+		path := strings.TrimPrefix(key, "file:")
+		secretBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", Error(err, "Could not read secret file "+path)
+		}
+		return strings.TrimSpace(string(secretBytes)), nil
+	}
+
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", errors.New(F("Environment variable '%s' is not set", key))
+	}
+	return value, nil
+}
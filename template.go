@@ -0,0 +1,381 @@
+package gxutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/markbates/pkger"
+	"gopkg.in/yaml.v2"
+)
+
+// TemplatesDir is a folder of yaml templates (`base.yaml`, `<type>.yaml`)
+// layered over the embedded ones. A connection can override it
+// with the `templates_dir` property.
+var TemplatesDir = os.Getenv("GXUTIL_TEMPLATES_DIR")
+
+func newTemplate() Template {
+	return Template{
+		Core:           map[string]string{},
+		Metadata:       map[string]string{},
+		Analysis:       map[string]string{},
+		Function:       map[string]string{},
+		GeneralTypeMap: map[string]string{},
+		NativeTypeMap:  map[string]string{},
+		Variable:       map[string]string{},
+		Routine:        map[string]string{},
+		ErrorFilter:    map[string]string{},
+		sources:        map[string]string{},
+	}
+}
+
+// sections returns the template sections by their yaml key
+func (t *Template) sections() map[string]map[string]string {
+	return map[string]map[string]string{
+		"core":             t.Core,
+		"metadata":         t.Metadata,
+		"analysis":         t.Analysis,
+		"function":         t.Function,
+		"general_type_map": t.GeneralTypeMap,
+		"native_type_map":  t.NativeTypeMap,
+		"variable":         t.Variable,
+		"routine":          t.Routine,
+		"error_filter":     t.ErrorFilter,
+	}
+}
+
+// merge layers the values of `layer` over the template, key by key
+func (t *Template) merge(layer Template, source string) {
+	layerSections := layer.sections()
+	for name, section := range t.sections() {
+		for key, val := range layerSections[name] {
+			section[key] = val
+			t.sources[name+"."+key] = source
+		}
+	}
+}
+
+// Get returns the value of a `section.key` path
+func (t *Template) Get(path string) (value string) {
+	for name, section := range t.sections() {
+		if strings.HasPrefix(path, name+".") {
+			return section[strings.TrimPrefix(path, name+".")]
+		}
+	}
+	return
+}
+
+// Source returns the file that the value of a `section.key` path came from
+func (t *Template) Source(path string) string {
+	return t.sources[path]
+}
+
+// readEmbeddedTemplate reads a file of the `templates` folder, embedded with pkger
+func readEmbeddedTemplate(name string) (templateBytes []byte, err error) {
+	_, filename, _, _ := runtime.Caller(0)
+	templatePath := path.Join(path.Dir(filename), "templates", name)
+	templateFile, err := pkger.Open(templatePath)
+	if err != nil {
+		return nil, Error(err, "pkger.Open()"+templatePath)
+	}
+	defer templateFile.Close()
+	return ioutil.ReadAll(templateFile)
+}
+
+// TemplateTypes returns the sorted connection types of the embedded
+// templates, with the types of the registered drivers shipping their
+// template outside of gxutil
+func TemplateTypes() (types []string, err error) {
+	_, filename, _, _ := runtime.Caller(0)
+	templatesPath := path.Join(path.Dir(filename), "templates")
+
+	seen := map[string]bool{}
+	err = pkger.Walk(templatesPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name := info.Name()
+		if filepath.Ext(name) != ".yaml" || name == "base.yaml" || strings.HasPrefix(name, "profile.") {
+			return nil
+		}
+		connType := strings.TrimSuffix(name, ".yaml")
+		if !seen[connType] {
+			seen[connType] = true
+			types = append(types, connType)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, Error(err, "pkger.Walk()"+templatesPath)
+	}
+
+	for _, connType := range RegisteredTypes() {
+		driver, _ := GetConnDriver(connType)
+		if filepath.IsAbs(driver.TemplateFile) && !seen[connType] {
+			seen[connType] = true
+			types = append(types, connType)
+		}
+	}
+	sort.Strings(types)
+
+	return types, nil
+}
+
+// templateLayer is the raw content of a template file
+type templateLayer struct {
+	bytes  []byte
+	source string
+}
+
+// loadTemplateLayers reads the template files of a connection type,
+// in the order they are layered
+func loadTemplateLayers(connType string, overrideDir string) (layers []templateLayer, err error) {
+	templateFile := connType + ".yaml"
+	if driver, ok := GetConnDriver(connType); ok {
+		templateFile = driver.TemplateFile
+	}
+
+	baseTemplateBytes, err := readEmbeddedTemplate("base.yaml")
+	if err != nil {
+		return layers, Error(err, "box.FindString('base.yaml')")
+	}
+	layers = append(layers, templateLayer{baseTemplateBytes, "templates/base.yaml"})
+
+	var templateBytes []byte
+	if filepath.IsAbs(templateFile) {
+		// template shipped outside of gxutil, by a registered connection
+		templateBytes, err = ioutil.ReadFile(templateFile)
+		layers = append(layers, templateLayer{templateBytes, templateFile})
+	} else {
+		templateBytes, err = readEmbeddedTemplate(templateFile)
+		layers = append(layers, templateLayer{templateBytes, "templates/" + templateFile})
+	}
+	if err != nil {
+		return layers, Error(err, "box.FindString('.yaml') for "+connType)
+	}
+
+	if overrideDir != "" {
+		for _, name := range []string{"base.yaml", filepath.Base(templateFile)} {
+			overridePath := filepath.Join(overrideDir, name)
+			overrideBytes, err := ioutil.ReadFile(overridePath)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return layers, Error(err, "Could not read template override "+overridePath)
+			}
+			layers = append(layers, templateLayer{overrideBytes, overridePath})
+		}
+	}
+
+	return layers, nil
+}
+
+// LoadTemplate loads the template of a connection type: the embedded
+// `base.yaml` and type file, then the same files found in overrideDir
+func LoadTemplate(connType string, overrideDir string) (template Template, err error) {
+	template = newTemplate()
+
+	layers, err := loadTemplateLayers(connType, overrideDir)
+	if err != nil {
+		return template, err
+	}
+
+	for _, l := range layers {
+		layerTemplate := Template{}
+		err = yaml.Unmarshal(l.bytes, &layerTemplate)
+		if err != nil {
+			return template, Error(err, "yaml.Unmarshal for "+l.source)
+		}
+		template.merge(layerTemplate, l.source)
+	}
+
+	return template, nil
+}
+
+// TemplateIssue is a problem found by ValidateTemplate
+type TemplateIssue struct {
+	Type    string `json:"type"`   // the connection type
+	Kind    string `json:"kind"`   // missing_key, unknown_section, placeholder or type_map
+	Path    string `json:"path"`   // the `section.key` path, or section
+	Source  string `json:"source"` // the file of the value, if any
+	Message string `json:"message"`
+}
+
+func (issue TemplateIssue) String() string {
+	if issue.Source == "" {
+		return F("[%s] %s %s: %s", issue.Type, issue.Kind, issue.Path, issue.Message)
+	}
+	return F("[%s] %s %s (%s): %s", issue.Type, issue.Kind, issue.Path, issue.Source, issue.Message)
+}
+
+var (
+	// templateRequiredKeys are the keys needed by all connection types
+	templateRequiredKeys = []string{
+		"core.drop_table", "core.drop_view", "core.create_table", "core.limit",
+		"metadata.schemas", "metadata.tables", "metadata.views", "metadata.columns",
+		"metadata.primary_keys", "metadata.indexes", "metadata.columns_full",
+		"metadata.schemata", "metadata.ddl_table", "metadata.ddl_view",
+		"variable.bind_string", "variable.ddl_col",
+	}
+
+	// templateTypeRequiredKeys are the keys needed by a connection type
+	templateTypeRequiredKeys = map[string][]string{
+		"oracle":   {"core.sqlldr"},
+		"redshift": {"core.copy_to", "core.unload"},
+	}
+
+	// templateSuppliedValues are the placeholders the callers of a key supply
+	templateSuppliedValues = map[string][]string{
+		"core.drop_table":       {"table"},
+		"core.drop_view":        {"view"},
+		"core.create_table":     {"table", "col_types"},
+		"core.limit":            {"fields", "table", "limit"},
+		"core.rename_table":     {"table", "new_table"},
+		"core.insert_temp":      {"table", "cols", "temp_table"},
+		"core.sqlldr":           {"table", "columns"},
+		"core.copy_to":          {"tgt_table", "s3_bucket", "s3_path", "aws_access_key_id", "aws_secret_access_key"},
+		"core.unload":           {"sql", "s3_bucket", "s3_path", "aws_access_key_id", "aws_secret_access_key"},
+		"metadata.schemas":      {},
+		"metadata.tables":       {"schema"},
+		"metadata.views":        {"schema"},
+		"metadata.objects":      {"schema", "object_type"},
+		"metadata.columns":      {"schema", "table"},
+		"metadata.columns_full": {"schema", "table"},
+		"metadata.primary_keys": {"schema", "table"},
+		"metadata.indexes":      {"schema", "table"},
+		"metadata.ddl_table":    {"schema", "table"},
+		"metadata.ddl_view":     {"schema", "table"},
+		"metadata.schemata":     {"schema"},
+		"function.sleep":        {"seconds"},
+		"variable.bind_string":  {"i", "field"},
+	}
+
+	// templateGeneralTypes are the general types produced by InferColumnTypes,
+	// and by the scans of timestamptz, binary, json and array columns
+	templateGeneralTypes = []string{
+		"string", "text", "integer", "decimal", "bool", "datetime",
+		"timestamptz", "binary", "json", "array",
+	}
+
+	templatePlaceholderRegex = regexp.MustCompile(`\{([^{}]*)\}`)
+)
+
+// ValidateTemplate checks the template of a connection type (with the
+// overrides of overrideDir) and returns the issues found: missing required
+// keys, unknown top-level sections, placeholders that the callers never
+// supply and general types with no native type.
+func ValidateTemplate(connType string, overrideDir string) (issues []TemplateIssue, err error) {
+	layers, err := loadTemplateLayers(connType, overrideDir)
+	if err != nil {
+		return issues, err
+	}
+
+	template, err := LoadTemplate(connType, overrideDir)
+	if err != nil {
+		return issues, err
+	}
+
+	addIssue := func(kind, path, message string) {
+		issues = append(issues, TemplateIssue{
+			Type:    connType,
+			Kind:    kind,
+			Path:    path,
+			Source:  template.Source(path),
+			Message: message,
+		})
+	}
+
+	// unknown sections, per file
+	known := template.sections()
+	for _, l := range layers {
+		rawTemplate := map[string]interface{}{}
+		err = yaml.Unmarshal(l.bytes, &rawTemplate)
+		if err != nil {
+			return issues, Error(err, "yaml.Unmarshal for "+l.source)
+		}
+
+		sectionNames := []string{}
+		for name := range rawTemplate {
+			sectionNames = append(sectionNames, name)
+		}
+		sort.Strings(sectionNames)
+
+		for _, name := range sectionNames {
+			if _, ok := known[name]; !ok {
+				issues = append(issues, TemplateIssue{
+					Type:    connType,
+					Kind:    "unknown_section",
+					Path:    name,
+					Source:  l.source,
+					Message: "section is not read, its values are ignored",
+				})
+			}
+		}
+	}
+
+	// missing keys
+	requiredKeys := append([]string{}, templateRequiredKeys...)
+	requiredKeys = append(requiredKeys, templateTypeRequiredKeys[connType]...)
+	for _, path := range requiredKeys {
+		if strings.TrimSpace(template.Get(path)) == "" {
+			addIssue("missing_key", path, "required key is missing or empty")
+		}
+	}
+
+	// placeholders never supplied
+	paths := []string{}
+	for path := range templateSuppliedValues {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		supplied := map[string]bool{}
+		for _, name := range templateSuppliedValues[path] {
+			supplied[name] = true
+		}
+
+		for _, match := range templatePlaceholderRegex.FindAllStringSubmatch(template.Get(path), -1) {
+			if !supplied[match[1]] {
+				addIssue(
+					"placeholder", path,
+					F("placeholder '{%s}' is never supplied (supplied: %s)", match[1], strings.Join(templateSuppliedValues[path], ", ")),
+				)
+			}
+		}
+	}
+
+	// general types with no native type
+	generalTypes := map[string]bool{}
+	for _, generalType := range templateGeneralTypes {
+		generalTypes[generalType] = true
+	}
+	for _, generalType := range template.NativeTypeMap {
+		generalTypes[generalType] = true
+	}
+	for generalType := range template.GeneralTypeMap {
+		generalTypes[generalType] = true
+	}
+
+	generalTypeNames := []string{}
+	for generalType := range generalTypes {
+		generalTypeNames = append(generalTypeNames, generalType)
+	}
+	sort.Strings(generalTypeNames)
+
+	for _, generalType := range generalTypeNames {
+		if strings.TrimSpace(template.GeneralTypeMap[generalType]) == "" {
+			addIssue(
+				"type_map", "general_type_map."+generalType,
+				F("general type '%s' has no native equivalent", generalType),
+			)
+		}
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,129 @@
+package gxutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateOverride(t *testing.T) {
+	overrideDir, err := ioutil.TempDir("", "gxutil_templates")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(overrideDir)
+
+	overridePath := filepath.Join(overrideDir, "postgres.yaml")
+	err = ioutil.WriteFile(overridePath, []byte(`
+metadata:
+  schemas: select nspname as schema_name from pg_namespace
+
+analysis:
+  table_size: select pg_total_relation_size('{schema}.{table}') as size
+`), 0644)
+	assert.NoError(t, err)
+
+	template, err := LoadTemplate("postgres", overrideDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "select nspname as schema_name from pg_namespace", template.Get("metadata.schemas"))
+	assert.Equal(t, overridePath, template.Source("metadata.schemas"))
+	assert.Equal(t, overridePath, template.Source("analysis.table_size"))
+
+	// untouched keys of the same sections are kept
+	assert.NotEmpty(t, template.Get("metadata.tables"))
+	assert.Equal(t, "templates/postgres.yaml", template.Source("metadata.tables"))
+	assert.Equal(t, "templates/base.yaml", template.Source("analysis.table_count"))
+	assert.Equal(t, "drop table if exists {table} cascade", template.Get("core.drop_table"))
+
+	conn := &BaseConn{Type: "postgres"}
+	conn.SetProp("templates_dir", overrideDir)
+	err = conn.LoadYAML()
+	assert.NoError(t, err)
+	assert.Equal(t, "select nspname as schema_name from pg_namespace", conn.GetTemplateValue("metadata.schemas"))
+	assert.Equal(t, overridePath, conn.Template().Source("metadata.schemas"))
+}
+
+func TestTemplateSections(t *testing.T) {
+	template, err := LoadTemplate("mysql", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, template.Get("routine.number_min_max"), "min({field}) as min_val")
+	assert.Equal(t, "Error 1051", template.Get("error_filter.table_not_exist"))
+
+	// matched on the driver error, not the SQL
+	conn := BaseConn{Type: "mysql", template: template}
+	sql := "drop table if exists mysql.place cascade"
+	assert.True(t, conn.matchErrorFilter("table_not_exist", Error(errors.New("Error 1051: Unknown table 'mysql.place'"), "Error for "+sql)))
+	assert.False(t, conn.matchErrorFilter("table_not_exist", Error(errors.New("Error 1142: DROP command denied to user"), "Error for "+sql)))
+	assert.False(t, conn.matchErrorFilter("table_not_exist", nil))
+
+	template, err = LoadTemplate("postgres", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn = BaseConn{Type: "postgres", template: template}
+	assert.True(t, conn.matchErrorFilter("table_not_exist", Error(errors.New(`pq: schema "missing" does not exist`), "Error for drop table if exists missing.place")))
+	assert.False(t, conn.matchErrorFilter("table_not_exist", Error(errors.New("pq: permission denied for table place"), "Error for drop table if exists public.place")))
+
+	template, err = LoadTemplate("oracle", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, template.Get("routine.date_trunc_min_max"))
+	assert.Equal(t, "ORA-00942", template.Get("error_filter.table_not_exist"))
+	assert.Equal(t, "templates/oracle.yaml", template.Source("error_filter.table_not_exist"))
+}
+
+func TestValidateTemplate(t *testing.T) {
+	hasIssue := func(issues []TemplateIssue, kind, path string) bool {
+		for _, issue := range issues {
+			if issue.Kind == kind && issue.Path == path {
+				return true
+			}
+		}
+		return false
+	}
+
+	issues, err := ValidateTemplate("hive", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, hasIssue(issues, "unknown_section", "functions"))
+	assert.True(t, hasIssue(issues, "unknown_section", "variables"))
+	assert.True(t, hasIssue(issues, "placeholder", "core.drop_table"))
+	assert.True(t, hasIssue(issues, "type_map", "general_type_map.bool"))
+
+	issues, err = ValidateTemplate("sqlserver", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, hasIssue(issues, "missing_key", "metadata.schemas"))
+	assert.True(t, hasIssue(issues, "missing_key", "metadata.schemata"))
+
+	issues, err = ValidateTemplate("mysql", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, hasIssue(issues, "missing_key", "metadata.schemas"))
+	assert.False(t, hasIssue(issues, "placeholder", "core.drop_table"))
+
+	types, err := TemplateTypes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bigquery", "hive", "mysql", "oracle", "postgres", "redshift", "snowflake", "spark", "sqlite3", "sqlserver"}, types)
+
+	for _, connType := range []string{"base", "bigquery", "hive", "mysql", "oracle", "postgres", "redshift", "snowflake", "spark", "sqlite3", "sqlserver"} {
+		issues, err = ValidateTemplate(connType, "")
+		assert.NoError(t, err)
+		for _, generalType := range []string{"binary", "json", "array"} {
+			assert.False(t, hasIssue(issues, "type_map", "general_type_map."+generalType), connType+" "+generalType)
+		}
+	}
+}
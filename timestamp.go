@@ -0,0 +1,37 @@
+package gxutil
+
+import (
+	"time"
+)
+
+// TargetTimezone is the timezone that the "timestamptz" values are
+// normalised to when written (CSV, Parquet, inserts and bulk loads),
+// keeping their instant. It should match the session timezone of
+// the targets without timezone types (e.g. MySQL datetime).
+var TargetTimezone = time.UTC
+
+const (
+	// DatetimeLayout is the layout of the written datetimes,
+	// the fractional seconds are kept (and trimmed of zeros)
+	DatetimeLayout = "2006-01-02 15:04:05.999999999"
+
+	// TimestampTZLayout is the layout of the written "timestamptz" values
+	TimestampTZLayout = "2006-01-02 15:04:05.999999999-07:00"
+)
+
+// normalizeTime returns val in TargetTimezone, if val is a
+// time of a "timestamptz" column
+func normalizeTime(val interface{}, colType string) interface{} {
+	if t, ok := val.(time.Time); ok && colType == "timestamptz" && TargetTimezone != nil {
+		return t.In(TargetTimezone)
+	}
+	return val
+}
+
+// formatTime returns the text of t, with its offset for a "timestamptz" column
+func formatTime(t time.Time, colType string) string {
+	if colType == "timestamptz" {
+		return normalizeTime(t, colType).(time.Time).Format(TimestampTZLayout)
+	}
+	return t.Format(DatetimeLayout)
+}
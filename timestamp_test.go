@@ -0,0 +1,52 @@
+package gxutil
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampTZ(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if !assert.NoError(t, err) {
+		return
+	}
+	ts := time.Date(2020, 3, 25, 10, 30, 15, 123456789, ny)
+
+	assert.Equal(t, "2020-03-25 10:30:15.123456789", toString(ts))
+	assert.Equal(t, "2020-03-25 10:30:15", toString(ts.Truncate(time.Second)))
+	assert.Equal(t, "2020-03-25 14:30:15.123456789+00:00", formatTime(ts, "timestamptz"))
+
+	TargetTimezone = ny
+	assert.Equal(t, "2020-03-25 10:30:15.123456789-04:00", formatTime(ts.UTC(), "timestamptz"))
+	TargetTimezone = time.UTC
+
+	// same instant, read back
+	parsed := castVal("2020-03-25 14:30:15.123456789+00:00", "timestamptz")
+	assert.True(t, ts.Equal(parsed.(time.Time)))
+	parsed = castVal("2020-03-25T10:30:15.123456789-04:00", "timestamptz")
+	assert.True(t, ts.Equal(parsed.(time.Time)))
+
+	data := Dataset{
+		Columns: []Column{{Name: "ts", Type: "timestamptz"}, {Name: "dt", Type: "datetime"}},
+		Rows:    [][]interface{}{{ts, ts}},
+	}
+
+	csvPath := "test/timestamptz.csv"
+	defer os.Remove(csvPath)
+	_, err = (&CSV{Path: csvPath}).WriteStream(data.Stream())
+	assert.NoError(t, err)
+
+	csvBytes, err := ioutil.ReadFile(csvPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "ts,dt\n2020-03-25 14:30:15.123456789+00:00,2020-03-25 10:30:15.123456789\n", string(csvBytes))
+
+	// bulk loads, in the target timezone
+	ds := data.Stream()
+	csvBytes, err = ioutil.ReadAll(ds.NewCsvReader(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "ts,dt\n2020-03-25 14:30:15.123456789,2020-03-25 10:30:15.123456789\n", string(csvBytes))
+}